@@ -0,0 +1,138 @@
+package admin
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jrwynneiii/ccsds_tools/lrit"
+)
+
+// Administrative messages: operator notices about outages, schedule changes and the like, sent as text files on VCID 0
+
+const AdminVCID = 0
+
+// LRIT file type for alphanumeric text
+const TextFileType = 2
+
+type Message struct {
+	Filename string `json:"filename"`
+	// First non-blank line of the message
+	Title string `json:"title"`
+	Text  string `json:"text"`
+	// From the file's timestamp header, if it has one, otherwise when it was received
+	Time     time.Time `json:"time"`
+	Received time.Time `json:"received"`
+}
+
+func IsAdminMessage(lf *lrit.File) bool {
+	return lf.VCID == AdminVCID && lf.PrimaryHeader.FileType == TextFileType
+}
+
+func Parse(lf *lrit.File) (Message, error) {
+	if lf.PrimaryHeader.FileType != TextFileType {
+		return Message{}, fmt.Errorf("%s is not a text file (file type %d)", lf.GetName(), lf.PrimaryHeader.FileType)
+	}
+
+	text := strings.ReplaceAll(string(lf.Payload()), "\r", "")
+	text = strings.TrimSpace(strings.Trim(text, "\x00"))
+	m := Message{
+		Filename: lf.GetName(),
+		Text:     text,
+		Received: time.Now(),
+		Time:     lf.Timestamp(),
+	}
+	if m.Time.IsZero() {
+		m.Time = m.Received
+	}
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			m.Title = line
+			break
+		}
+	}
+	return m, nil
+}
+
+// Identifies repeats of the same message, which are rebroadcast periodically
+func (m Message) key() string {
+	return fmt.Sprintf("%s/%x", m.Filename, sha256.Sum256([]byte(m.Text)))
+}
+
+type Handler func(m Message)
+
+// Keeps the most recent admin messages, and calls back when a new one arrives
+type History struct {
+	mutex    sync.RWMutex
+	Max      int
+	messages []Message
+	seen     map[string]bool
+	handlers []Handler
+}
+
+func NewHistory(max int) *History {
+	return &History{
+		Max:  max,
+		seen: make(map[string]bool),
+	}
+}
+
+// Registers a callback for new messages. Repeats of a message already in the history don't trigger it
+func (h *History) OnMessage(fn Handler) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.handlers = append(h.handlers, fn)
+}
+
+// Adds a message to the history. Returns false if it was a repeat
+func (h *History) Add(m Message) bool {
+	h.mutex.Lock()
+	key := m.key()
+	if h.seen[key] {
+		h.mutex.Unlock()
+		return false
+	}
+	h.seen[key] = true
+	h.messages = append(h.messages, m)
+	if h.Max > 0 && len(h.messages) > h.Max {
+		delete(h.seen, h.messages[0].key())
+		h.messages = h.messages[1:]
+	}
+	handlers := append([]Handler{}, h.handlers...)
+	h.mutex.Unlock()
+
+	for _, fn := range handlers {
+		fn(m)
+	}
+	return true
+}
+
+// Parses and adds an LRIT file, if it is an admin message
+func (h *History) Process(lf *lrit.File) (Message, bool) {
+	if !IsAdminMessage(lf) {
+		return Message{}, false
+	}
+	m, err := Parse(lf)
+	if err != nil {
+		return m, false
+	}
+	return m, h.Add(m)
+}
+
+// Returns the retained messages, oldest first
+func (h *History) Messages() []Message {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return append([]Message{}, h.messages...)
+}
+
+func (h *History) Latest() (Message, bool) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if len(h.messages) == 0 {
+		return Message{}, false
+	}
+	return h.messages[len(h.messages)-1], true
+}
@@ -0,0 +1,205 @@
+package dcs
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jrwynneiii/ccsds_tools/lrit"
+	"github.com/jrwynneiii/ccsds_tools/packets"
+)
+
+// Decoder for the GOES DCS (Data Collection System) files carried on VCIDs 30-32. Each file has a 64 byte header,
+// followed by blocks of DCP (Data Collection Platform) messages, followed by a CRC32 of the whole file. Multi-byte
+// binary fields are little endian; times are BCD YYDDDHHMMSSmmm
+
+const (
+	fileHeaderLength    = 64
+	blockHeaderLength   = 3
+	messageHeaderLength = 37
+
+	DCPMessageBlockID = 1
+)
+
+type FileHeader struct {
+	Name   string `json:"name"`
+	Length int    `json:"length"`
+	Source string `json:"source"`
+	Type   string `json:"type"`
+}
+
+type Message struct {
+	SequenceNumber uint32 `json:"sequence_number"`
+	// Platform address as the usual 8 hex digit DCP ID, as corrected by the ground system
+	Address string `json:"address"`
+	// Baud rate of the message: 100, 300 or 1200
+	BaudRate int `json:"baud_rate"`
+	// Flags from the demodulator and the address/timing checks (ARM flags)
+	Flags    uint8 `json:"flags"`
+	ARMFlags uint8 `json:"arm_flags"`
+
+	CarrierStart time.Time `json:"carrier_start"`
+	MessageEnd   time.Time `json:"message_end"`
+
+	// dBm
+	SignalStrength float64 `json:"signal_strength"`
+	// Hz
+	FrequencyOffset float64 `json:"frequency_offset"`
+	// Degrees RMS
+	PhaseNoise      float64 `json:"phase_noise"`
+	ModulationIndex float64 `json:"modulation_index"`
+	// Percentage
+	GoodPhase float64 `json:"good_phase"`
+
+	Channel    uint16 `json:"channel"`
+	Spacecraft string `json:"spacecraft"`
+	Source     string `json:"source"`
+
+	Data    []byte `json:"data"`
+	CRCGood bool   `json:"crc_good"`
+}
+
+type File struct {
+	Header   FileHeader `json:"header"`
+	Messages []Message  `json:"messages"`
+}
+
+// Parses the data of a DCS LRIT file
+func Parse(data []byte) (*File, error) {
+	if len(data) < fileHeaderLength {
+		return nil, fmt.Errorf("DCS file too short for its header: %d bytes", len(data))
+	}
+
+	f := &File{}
+	h := data[:fileHeaderLength]
+	f.Header.Name = strings.TrimRight(string(h[0:32]), " \x00")
+	f.Header.Source = strings.TrimRight(string(h[40:44]), " \x00")
+	f.Header.Type = strings.TrimRight(string(h[44:48]), " \x00")
+	length, err := strconv.Atoi(strings.TrimSpace(string(h[32:40])))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid DCS file length %q: %s", h[32:40], err.Error())
+	}
+	f.Header.Length = length
+
+	// Drop the trailing file CRC32
+	body := data[fileHeaderLength:]
+	if len(body) >= 4 {
+		body = body[:len(body)-4]
+	}
+
+	for len(body) >= blockHeaderLength {
+		id := body[0]
+		length := int(binary.LittleEndian.Uint16(body[1:3]))
+		if length < blockHeaderLength || length > len(body) {
+			return f, fmt.Errorf("Invalid DCS block length %d (%d bytes left)", length, len(body))
+		}
+
+		if id == DCPMessageBlockID {
+			if msg, err := parseMessage(body[:length]); err == nil {
+				f.Messages = append(f.Messages, msg)
+			} else {
+				return f, err
+			}
+		}
+		body = body[length:]
+	}
+	return f, nil
+}
+
+// Parses the DCS file out of an LRIT file
+func FromLRIT(lf *lrit.File) (*File, error) {
+	if lf.FindSecondaryHeader(lrit.DCSFilenameHeaderType) == nil {
+		return nil, fmt.Errorf("%s is not a DCS file", lf.GetName())
+	}
+	return Parse(lf.Payload())
+}
+
+func parseMessage(block []byte) (Message, error) {
+	if len(block) < blockHeaderLength+messageHeaderLength+2 {
+		return Message{}, fmt.Errorf("DCP message block too short: %d bytes", len(block))
+	}
+
+	crc := binary.LittleEndian.Uint16(block[len(block)-2:])
+	m := Message{
+		CRCGood: packets.CalcCRCBuffer(block[:len(block)-2]) == crc,
+	}
+
+	b := block[blockHeaderLength : len(block)-2]
+	m.SequenceNumber = uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+	m.Flags = b[3]
+	switch m.Flags & 0x7 {
+	case 1:
+		m.BaudRate = 100
+	case 2:
+		m.BaudRate = 300
+	case 3:
+		m.BaudRate = 1200
+	}
+	m.ARMFlags = b[4]
+	m.Address = fmt.Sprintf("%08X", binary.LittleEndian.Uint32(b[5:9]))
+
+	var err error
+	if m.CarrierStart, err = bcdTime(b[9:16]); err != nil {
+		return m, err
+	}
+	if m.MessageEnd, err = bcdTime(b[16:23]); err != nil {
+		return m, err
+	}
+
+	m.SignalStrength = float64(binary.LittleEndian.Uint16(b[23:25])&0x3ff) / 10
+	// 14 bit two's complement
+	offset := int16(binary.LittleEndian.Uint16(b[25:27])<<2) >> 2
+	m.FrequencyOffset = float64(offset) / 10
+	m.PhaseNoise = float64(binary.LittleEndian.Uint16(b[27:29])&0xfff) / 100
+	m.ModulationIndex = float64(b[29]) / 100
+	m.GoodPhase = float64(b[30]) / 2
+	m.Channel = binary.LittleEndian.Uint16(b[31:33]) & 0x3ff
+	m.Spacecraft = strings.TrimRight(string(b[33:35]), " \x00")
+	m.Source = strings.TrimRight(string(b[35:37]), " \x00")
+	m.Data = b[messageHeaderLength:]
+
+	return m, nil
+}
+
+// Decodes a 7 byte BCD YYDDDHHMMSSmmm time
+func bcdTime(b []byte) (time.Time, error) {
+	var digits []int
+	for _, v := range b {
+		hi, lo := int(v>>4), int(v&0xf)
+		if hi > 9 || lo > 9 {
+			return time.Time{}, fmt.Errorf("Invalid BCD digit in DCS time: %#02x", v)
+		}
+		digits = append(digits, hi, lo)
+	}
+	num := func(d []int) int {
+		n := 0
+		for _, v := range d {
+			n = n*10 + v
+		}
+		return n
+	}
+
+	year := 2000 + num(digits[0:2])
+	doy := num(digits[2:5])
+	ms := num(digits[11:14])
+	return time.Date(year, time.January, doy, num(digits[5:7]), num(digits[7:9]), num(digits[9:11]), ms*int(time.Millisecond), time.UTC), nil
+}
+
+// Writes each message as a JSON record, one per line, tagged with the file it came from
+func (f *File) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for _, m := range f.Messages {
+		record := struct {
+			File string `json:"file"`
+			Message
+		}{f.Header.Name, m}
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package dcs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jrwynneiii/ccsds_tools/packets"
+)
+
+// Builds a DCS file with the given length field around a single 300 baud DCP message and a non-message block
+func dcsFile(length string) []byte {
+	msg := []byte{
+		0x39, 0x30, 0x00, // Sequence number 12345
+		0x02,                   // 300 baud
+		0x00,                   // ARM flags
+		0xb4, 0xa2, 0xd1, 0x16, // Address 16D1A2B4
+		0x24, 0x11, 0x02, 0x15, 0x43, 0x11, 0x23, // Carrier start 2024 day 110 21:54:31.123
+		0x24, 0x11, 0x02, 0x15, 0x43, 0x24, 0x56, // Message end 2024 day 110 21:54:32.456
+		0xb3, 0x01, // 43.5 dBm
+		0x83, 0x3f, // -12.5 Hz
+		0xe1, 0x00, // 2.25 degrees
+		0x50,       // 0.80
+		0xc6,       // 99%
+		0x83, 0x00, // Channel 131
+		'E', ' ',
+		'W', 'E',
+	}
+	msg = append(msg, "ABCDEF"...)
+
+	block := []byte{DCPMessageBlockID, 0, 0}
+	block = append(block, msg...)
+	binary.LittleEndian.PutUint16(block[1:3], uint16(len(block)+2))
+	block = binary.LittleEndian.AppendUint16(block, packets.CalcCRCBuffer(block))
+
+	header := fmt.Sprintf("%-32s%-8s%-4s%-4s%-12s", "pH-24110215432-A.dcs", length, "NOAA", "DCSH", "")
+	data := append([]byte(header), 0, 0, 0, 0)
+	data = append(data, block...)
+	data = append(data, 2, 5, 0, 0xaa, 0xbb)
+	// File CRC32, which isn't checked
+	return append(data, 0, 0, 0, 0)
+}
+
+func TestParse(t *testing.T) {
+	f, err := Parse(dcsFile("00000121"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantHeader := FileHeader{Name: "pH-24110215432-A.dcs", Length: 121, Source: "NOAA", Type: "DCSH"}
+	if f.Header != wantHeader {
+		t.Errorf("header %+v, want %+v", f.Header, wantHeader)
+	}
+	if len(f.Messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(f.Messages))
+	}
+
+	m := f.Messages[0]
+	if !m.CRCGood {
+		t.Error("message CRC is bad")
+	}
+	if m.SequenceNumber != 12345 || m.BaudRate != 300 || m.Address != "16D1A2B4" || m.Channel != 131 {
+		t.Errorf("got sequence %d, %d baud, address %s, channel %d", m.SequenceNumber, m.BaudRate, m.Address, m.Channel)
+	}
+	if want := time.Date(2024, time.April, 19, 21, 54, 31, 123000000, time.UTC); !m.CarrierStart.Equal(want) {
+		t.Errorf("carrier start %s, want %s", m.CarrierStart, want)
+	}
+	if want := time.Date(2024, time.April, 19, 21, 54, 32, 456000000, time.UTC); !m.MessageEnd.Equal(want) {
+		t.Errorf("message end %s, want %s", m.MessageEnd, want)
+	}
+	if m.SignalStrength != 43.5 || m.FrequencyOffset != -12.5 || m.PhaseNoise != 2.25 || m.ModulationIndex != 0.8 || m.GoodPhase != 99 {
+		t.Errorf("got %.1f dBm, %.1f Hz, %.2f degrees, index %.2f, %.1f%% good phase",
+			m.SignalStrength, m.FrequencyOffset, m.PhaseNoise, m.ModulationIndex, m.GoodPhase)
+	}
+	if m.Spacecraft != "E" || m.Source != "WE" || string(m.Data) != "ABCDEF" {
+		t.Errorf("got spacecraft %q, source %q, data %q", m.Spacecraft, m.Source, m.Data)
+	}
+}
+
+func TestParseGarbledLength(t *testing.T) {
+	for _, length := range []string{"", "00x00121", "0000012."} {
+		if f, err := Parse(dcsFile(length)); err == nil {
+			t.Errorf("length %q parsed as %d, want an error", length, f.Header.Length)
+		}
+	}
+}
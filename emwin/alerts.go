@@ -0,0 +1,204 @@
+package emwin
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// One segment of a watch/warning product: the area it covers and the events it carries
+type Alert struct {
+	AWIPSID string    `json:"awips_id"`
+	Heading Heading   `json:"heading"`
+	Issued  time.Time `json:"issued"`
+	UGC     UGC       `json:"ugc"`
+	VTEC    []VTEC    `json:"vtec"`
+	Text    string    `json:"text"`
+}
+
+// Splits a text bulletin into its segments (separated by $$), and returns the ones with a UGC group
+func ExtractAlerts(b Bulletin) []Alert {
+	if b.Kind != TextProduct {
+		return nil
+	}
+	ref := b.Issued
+	if ref.IsZero() {
+		ref = time.Now()
+	}
+
+	var ret []Alert
+	for _, segment := range strings.Split(b.Text, "$$") {
+		ugcs := ParseUGC(segment, ref)
+		if len(ugcs) == 0 {
+			continue
+		}
+		ret = append(ret, Alert{
+			AWIPSID: b.AWIPSID,
+			Heading: b.Heading,
+			Issued:  b.Issued,
+			UGC:     ugcs[0],
+			VTEC:    ParseVTEC(segment),
+			Text:    strings.TrimSpace(segment),
+		})
+	}
+	return ret
+}
+
+// Whether any of the alert's events are in effect at the given time
+func (a Alert) Active(now time.Time) bool {
+	if !a.UGC.Expires.IsZero() && now.After(a.UGC.Expires) {
+		return false
+	}
+	for _, v := range a.VTEC {
+		if v.Active(now) {
+			return true
+		}
+	}
+	return false
+}
+
+type AlertHandler func(a Alert)
+
+// Fires callbacks for alerts that affect a set of zones/counties. By default only alerts that are still in effect are
+// passed, and each update to an event (its VTEC event ID and action) is only passed once
+type AlertFilter struct {
+	mutex sync.RWMutex
+	zones []string
+	// VTEC significance codes to pass. Defaults to warnings only
+	Significance []string
+	// VTEC phenomena codes to pass, e.g. TO, SV, FF. Empty passes every phenomenon
+	Phenomena []string
+	// Also pass test (T class) VTEC events
+	IncludeTests bool
+	// Also pass alerts that have expired, and events that have ended, been cancelled (CAN) or expired (EXP)
+	IncludeInactive bool
+	// Also pass repeats of event updates that have already been passed
+	IncludeDuplicates bool
+	handlers          []AlertHandler
+	// Event ID and action pairs that have been passed, and when they can be forgotten
+	seen map[string]time.Time
+	now  func() time.Time
+}
+
+func NewAlertFilter(zones ...string) *AlertFilter {
+	f := &AlertFilter{
+		Significance: []string{"W"},
+		seen:         make(map[string]time.Time),
+	}
+	f.AddZones(zones...)
+	return f
+}
+
+func (f *AlertFilter) AddZones(zones ...string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for _, z := range zones {
+		f.zones = append(f.zones, strings.ToUpper(strings.TrimSpace(z)))
+	}
+}
+
+// Registers a callback for matching alerts. Callbacks are called from whichever goroutine calls Process()
+func (f *AlertFilter) OnAlert(h AlertHandler) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.handlers = append(f.handlers, h)
+}
+
+// Whether the alert covers one of the filter's zones with an event the filter passes. Doesn't check for duplicates
+func (f *AlertFilter) Matches(a Alert) bool {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return len(f.matchingEvents(a, f.clock())) > 0
+}
+
+func (f *AlertFilter) clock() time.Time {
+	if f.now == nil {
+		return time.Now()
+	}
+	return f.now()
+}
+
+func (f *AlertFilter) matchingEvents(a Alert, now time.Time) []VTEC {
+	if !slices.ContainsFunc(f.zones, a.UGC.Covers) {
+		return nil
+	}
+	if !f.IncludeInactive && !a.UGC.Expires.IsZero() && now.After(a.UGC.Expires) {
+		return nil
+	}
+
+	var ret []VTEC
+	for _, v := range a.VTEC {
+		if v.Class == "T" && !f.IncludeTests {
+			continue
+		}
+		if len(f.Phenomena) > 0 && !slices.Contains(f.Phenomena, v.Phenomena) {
+			continue
+		}
+		if len(f.Significance) > 0 && !slices.Contains(f.Significance, v.Significance) {
+			continue
+		}
+		if !f.IncludeInactive && (v.Action == "CAN" || v.Action == "EXP" || (!v.End.IsZero() && !now.Before(v.End))) {
+			continue
+		}
+		ret = append(ret, v)
+	}
+	return ret
+}
+
+// Extracts the alerts from a bulletin, calls the handlers with the ones that match, and returns them
+func (f *AlertFilter) Process(b Bulletin) []Alert {
+	f.mutex.Lock()
+	now := f.clock()
+	if f.seen == nil {
+		f.seen = make(map[string]time.Time)
+	}
+	for k, forget := range f.seen {
+		if now.After(forget) {
+			delete(f.seen, k)
+		}
+	}
+
+	var matched []Alert
+	for _, a := range ExtractAlerts(b) {
+		events := f.matchingEvents(a, now)
+		if len(events) == 0 {
+			continue
+		}
+		if !f.IncludeDuplicates && !f.markSeen(a, events, now) {
+			continue
+		}
+		matched = append(matched, a)
+	}
+	handlers := slices.Clone(f.handlers)
+	f.mutex.Unlock()
+
+	for _, a := range matched {
+		for _, h := range handlers {
+			h(a)
+		}
+	}
+	return matched
+}
+
+// Remembers the alert's events, and returns whether any of them hadn't been seen before
+func (f *AlertFilter) markSeen(a Alert, events []VTEC, now time.Time) bool {
+	fresh := false
+	for _, v := range events {
+		key := v.EventID() + "." + v.Action
+		if _, ok := f.seen[key]; ok {
+			continue
+		}
+		fresh = true
+
+		forget := a.UGC.Expires
+		if v.End.After(forget) {
+			forget = v.End
+		}
+		if forget.IsZero() || forget.Before(now) {
+			forget = now.Add(24 * time.Hour)
+		}
+		f.seen[key] = forget
+	}
+	return fresh
+}
@@ -0,0 +1,61 @@
+package emwin
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func testWarning(action, ugc, vtecSig string) Bulletin {
+	text := fmt.Sprintf("WFUS53 KOAX 312150\nTOROAX\n\n%s\n/O.%s.KOAX.TO.%s.0012.240131T2150Z-240201T0000Z/\n\nTornado Warning for Douglas County\n\n$$\n",
+		ugc, action, vtecSig)
+	return Parse("TOROAXNE.TXT", []byte(text), time.Date(2024, 1, 31, 21, 55, 0, 0, time.UTC))
+}
+
+func TestAlertFilter(t *testing.T) {
+	now := time.Date(2024, 1, 31, 22, 0, 0, 0, time.UTC)
+	f := NewAlertFilter("NEC055")
+	f.now = func() time.Time { return now }
+	var fired []Alert
+	f.OnAlert(func(a Alert) { fired = append(fired, a) })
+
+	steps := []struct {
+		name string
+		b    Bulletin
+		want int
+	}{
+		{"new warning", testWarning("NEW", "NEC055-153-010000-", "W"), 1},
+		{"the same warning again", testWarning("NEW", "NEC055-153-010000-", "W"), 0},
+		{"an update", testWarning("CON", "NEC055-010000-", "W"), 1},
+		{"the same update again", testWarning("CON", "NEC055-010000-", "W"), 0},
+		{"cancelled", testWarning("CAN", "NEC055-010000-", "W"), 0},
+		{"expired", testWarning("EXP", "NEC055-010000-", "W"), 0},
+		{"another zone", testWarning("NEW", "NEC153-010000-", "W"), 0},
+		{"a watch", testWarning("NEW", "NEC055-010000-", "A"), 0},
+	}
+	for _, s := range steps {
+		fired = nil
+		if got := f.Process(s.b); len(got) != s.want || len(fired) != s.want {
+			t.Errorf("%s: got %d alerts and %d callbacks, want %d", s.name, len(got), len(fired), s.want)
+		}
+	}
+
+	// Once the UGC expiry time has passed, nothing from the segment is in effect
+	now = time.Date(2024, 2, 1, 0, 1, 0, 0, time.UTC)
+	if f.Matches(ExtractAlerts(testWarning("NEW", "NEC055-010000-", "W"))[0]) {
+		t.Error("matched an expired alert")
+	}
+}
+
+func TestAlertFilterIncludeInactive(t *testing.T) {
+	f := NewAlertFilter("NEC055")
+	f.now = func() time.Time { return time.Date(2024, 2, 1, 0, 1, 0, 0, time.UTC) }
+	f.IncludeInactive = true
+
+	if got := f.Process(testWarning("CAN", "NEC055-010000-", "W")); len(got) != 1 {
+		t.Errorf("got %d alerts, want the cancellation", len(got))
+	}
+	if got := f.Process(testWarning("NEW", "NEC055-010000-", "W")); len(got) != 1 {
+		t.Errorf("got %d alerts, want the expired warning", len(got))
+	}
+}
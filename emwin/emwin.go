@@ -0,0 +1,254 @@
+package emwin
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jrwynneiii/ccsds_tools/lrit"
+)
+
+// Decoder for EMWIN (Emergency Managers Weather Information Network) products, carried on VCIDs 20-22. Products
+// arrive either as plain text bulletins or as ZIP archives of text and graphics
+
+type Kind string
+
+const (
+	TextProduct    Kind = "text"
+	GraphicProduct Kind = "graphic"
+	OtherProduct   Kind = "other"
+)
+
+// WMO abbreviated heading, e.g. "WUUS53 KOAX 011200 CCA"
+type Heading struct {
+	// Data type designator and number, e.g. WUUS53
+	TTAAii string `json:"ttaaii"`
+	// Originating office, e.g. KOAX
+	CCCC string `json:"cccc"`
+	// Day of month, hour and minute the product was issued
+	YYGGgg string `json:"yygggg"`
+	// Amendment/correction/delay indicator, e.g. CCA. Empty for the original issuance
+	BBB string `json:"bbb,omitempty"`
+}
+
+type Bulletin struct {
+	Filename string  `json:"filename"`
+	Kind     Kind    `json:"kind"`
+	Heading  Heading `json:"heading"`
+	// AWIPS product ID (NNNXXX), e.g. TORFSD
+	AWIPSID string    `json:"awips_id,omitempty"`
+	Issued  time.Time `json:"issued"`
+	Text    string    `json:"text,omitempty"`
+	Data    []byte    `json:"-"`
+}
+
+var (
+	headingRe = regexp.MustCompile(`^([A-Z]{4}[0-9]{2}) ([A-Z0-9]{4}) ([0-9]{6})(?: ([A-Z]{3}))?$`)
+	awipsIDRe = regexp.MustCompile(`^[A-Z0-9]{4,6}$`)
+	// File names in the current EMWIN format, e.g.
+	// A_WUUS53KOAX011200CCA_C_KWIN_20240101120034_123456-2-TOROAXNE.TXT
+	filenameRe = regexp.MustCompile(`^[AZ]_([A-Z]{4}[0-9]{2})([A-Z0-9]{4})([0-9]{6})([A-Z]{3})?_C_KWIN_([0-9]{14})_[0-9]+-[0-9]+-([A-Z0-9]+)\.`)
+)
+
+func (h Heading) String() string {
+	s := fmt.Sprintf("%s %s %s", h.TTAAii, h.CCCC, h.YYGGgg)
+	if h.BBB != "" {
+		s += " " + h.BBB
+	}
+	return s
+}
+
+// Resolves the heading's day/hour/minute into a full time, taking the year and month from ref (usually the time the
+// product was received)
+func (h Heading) Time(ref time.Time) (time.Time, error) {
+	return resolveDayTime(h.YYGGgg, ref, true)
+}
+
+// Resolves a DDHHMM time against ref, which can be in a different month. With past set, the time is expected to be
+// at or before ref, like when a product was issued, and the latest match no more than a day after ref is used.
+// Otherwise it's expected to be after ref, like an expiry time, and the earliest match no more than a day before ref
+// is used
+func resolveDayTime(s string, ref time.Time, past bool) (time.Time, error) {
+	if len(s) != 6 {
+		return time.Time{}, fmt.Errorf("Invalid DDHHMM time: %q", s)
+	}
+	day, err1 := strconv.Atoi(s[0:2])
+	hour, err2 := strconv.Atoi(s[2:4])
+	minute, err3 := strconv.Atoi(s[4:6])
+	if err1 != nil || err2 != nil || err3 != nil || day < 1 || day > 31 || hour > 23 || minute > 59 {
+		return time.Time{}, fmt.Errorf("Invalid DDHHMM time: %q", s)
+	}
+
+	ref = ref.UTC()
+	var ret time.Time
+	for m := -2; m <= 2; m++ {
+		t := time.Date(ref.Year(), ref.Month()+time.Month(m), day, hour, minute, 0, 0, time.UTC)
+		if t.Day() != day {
+			// That month is too short
+			continue
+		}
+		if past && !t.After(ref.Add(24*time.Hour)) {
+			ret = t
+		} else if !past && !t.Before(ref.Add(-24*time.Hour)) {
+			return t, nil
+		}
+	}
+	if ret.IsZero() {
+		return ret, fmt.Errorf("Could not resolve DDHHMM time %q against %s", s, ref.Format(time.RFC3339))
+	}
+	return ret, nil
+}
+
+// Decodes the EMWIN products in an LRIT file from the session layer. ZIP archives are unpacked if the session layer
+// hasn't already done so
+func Decode(lf *lrit.File) ([]Bulletin, error) {
+	files := lf.UnzippedData
+	if len(files) == 0 {
+		data := lf.Payload()
+		name := lf.GetName()
+		if isZip(name, data) {
+			var err error
+			if files, err = unzip(data); err != nil {
+				return nil, fmt.Errorf("Could not unzip EMWIN product %s: %s", name, err.Error())
+			}
+		} else {
+			files = map[string][]byte{name: data}
+		}
+	}
+
+	ref := lf.Timestamp()
+	if ref.IsZero() {
+		ref = time.Now()
+	}
+
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var ret []Bulletin
+	for _, name := range names {
+		ret = append(ret, Parse(name, files[name], ref))
+	}
+	return ret, nil
+}
+
+func isZip(name string, data []byte) bool {
+	ext := strings.ToUpper(filepath.Ext(name))
+	return ext == ".ZIP" || ext == ".ZIS" || bytes.HasPrefix(data, []byte("PK\x03\x04"))
+}
+
+func unzip(data []byte) (map[string][]byte, error) {
+	ret := make(map[string][]byte)
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return ret, err
+	}
+	for _, file := range zr.File {
+		f, err := file.Open()
+		if err != nil {
+			return ret, err
+		}
+		ret[file.Name], err = io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return ret, err
+		}
+	}
+	return ret, nil
+}
+
+// Classifies and parses a single product
+func Parse(name string, data []byte, ref time.Time) Bulletin {
+	b := Bulletin{
+		Filename: name,
+		Kind:     Classify(name, data),
+		Data:     data,
+	}
+
+	var issued time.Time
+	if m := filenameRe.FindStringSubmatch(filepath.Base(name)); m != nil {
+		b.Heading = Heading{TTAAii: m[1], CCCC: m[2], YYGGgg: m[3], BBB: m[4]}
+		b.AWIPSID = m[6]
+		issued, _ = time.Parse("20060102150405", m[5])
+	}
+
+	if b.Kind == TextProduct {
+		b.Text = Normalize(data)
+		if h, id, ok := ParseHeading(b.Text); ok {
+			b.Heading = h
+			if id != "" {
+				b.AWIPSID = id
+			}
+		}
+	}
+
+	if t, err := b.Heading.Time(ref); err == nil {
+		b.Issued = t
+	} else {
+		b.Issued = issued
+	}
+	return b
+}
+
+func Classify(name string, data []byte) Kind {
+	switch strings.ToUpper(filepath.Ext(name)) {
+	case ".TXT":
+		return TextProduct
+	case ".GIF", ".JPG", ".JPEG", ".PNG":
+		return GraphicProduct
+	}
+	if bytes.HasPrefix(data, []byte("GIF8")) || bytes.HasPrefix(data, []byte("\x89PNG")) || bytes.HasPrefix(data, []byte("\xff\xd8\xff")) {
+		return GraphicProduct
+	}
+	if utf8.Valid(data) && !bytes.ContainsRune(data, 0) {
+		return TextProduct
+	}
+	return OtherProduct
+}
+
+// Strips the transmission control characters and CR/CR/LF line endings from a bulletin
+func Normalize(data []byte) string {
+	s := strings.Map(func(r rune) rune {
+		if r == '\x01' || r == '\x03' || r == '\x1e' {
+			return -1
+		}
+		return r
+	}, string(data))
+	s = strings.ReplaceAll(s, "\r", "")
+	return strings.TrimSpace(s)
+}
+
+// Finds the WMO heading, and the AWIPS ID on the line after it, in the first few lines of a bulletin
+func ParseHeading(text string) (Heading, string, bool) {
+	lines := strings.SplitN(text, "\n", 6)
+	for i, line := range lines {
+		m := headingRe.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		h := Heading{TTAAii: m[1], CCCC: m[2], YYGGgg: m[3], BBB: m[4]}
+		id := ""
+		if i+1 < len(lines) {
+			if next := strings.TrimSpace(lines[i+1]); awipsIDRe.MatchString(next) {
+				id = next
+			}
+		}
+		return h, id, true
+	}
+	return Heading{}, "", false
+}
+
+// Whether this product came from the given AWIPS product category (the NNN part of the ID), e.g. "TOR"
+func (b Bulletin) IsProduct(nnn string) bool {
+	return strings.HasPrefix(b.AWIPSID, strings.ToUpper(nnn))
+}
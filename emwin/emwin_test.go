@@ -0,0 +1,61 @@
+package emwin
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResolveDayTime(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		ref  string
+		past bool
+		want string
+	}{
+		{"issued earlier the same day", "151200", "2024-05-15T12:03:00Z", true, "2024-05-15T12:00:00Z"},
+		{"issued last month", "302300", "2024-05-01T00:10:00Z", true, "2024-04-30T23:00:00Z"},
+		{"issued across the new year", "312355", "2024-01-01T00:02:00Z", true, "2023-12-31T23:55:00Z"},
+		{"received with a slow clock at the end of the month", "010005", "2024-01-31T23:59:00Z", true, "2024-02-01T00:05:00Z"},
+		{"day that the previous month doesn't have", "310900", "2024-03-31T09:05:00Z", true, "2024-03-31T09:00:00Z"},
+		{"expires later the same day", "152100", "2024-05-15T18:00:00Z", false, "2024-05-15T21:00:00Z"},
+		{"expires next month", "010000", "2024-01-31T22:00:00Z", false, "2024-02-01T00:00:00Z"},
+		{"expires next year", "010600", "2023-12-31T20:00:00Z", false, "2024-01-01T06:00:00Z"},
+		{"expired shortly before it was received", "151100", "2024-05-15T12:00:00Z", false, "2024-05-15T11:00:00Z"},
+		{"expires on a day next month doesn't have", "310000", "2024-01-30T20:00:00Z", false, "2024-01-31T00:00:00Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref, _ := time.Parse(time.RFC3339, tt.ref)
+			want, _ := time.Parse(time.RFC3339, tt.want)
+			got, err := resolveDayTime(tt.s, ref, tt.past)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(want) {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	}
+
+	for _, s := range []string{"", "1200", "321200", "002400", "01ab00"} {
+		if _, err := resolveDayTime(s, time.Now(), true); err == nil {
+			t.Errorf("expected an error for %q", s)
+		}
+	}
+}
+
+func TestParseUGCExpiresNextMonth(t *testing.T) {
+	ref, _ := time.Parse(time.RFC3339, "2024-01-31T22:00:00Z")
+	ugcs := ParseUGC("NEC055-153-010000-\n", ref)
+	if len(ugcs) != 1 {
+		t.Fatalf("got %d UGC groups, want 1", len(ugcs))
+	}
+	if want := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC); !ugcs[0].Expires.Equal(want) {
+		t.Errorf("expires at %s, want %s", ugcs[0].Expires, want)
+	}
+	if !ugcs[0].Covers("NEC153") || ugcs[0].Covers("NEC154") {
+		t.Errorf("unexpected codes: %v", ugcs[0].Codes)
+	}
+}
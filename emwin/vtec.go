@@ -0,0 +1,167 @@
+package emwin
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// P-VTEC (Primary Valid Time Event Code), e.g. /O.NEW.KOAX.TO.W.0012.240501T2100Z-240501T2145Z/
+type VTEC struct {
+	// O (operational), T (test), E (experimental) or X (experimental VTEC in an operational product)
+	Class string `json:"class"`
+	// NEW, CON, EXT, EXA, EXB, UPG, CAN, EXP, COR or ROU
+	Action string `json:"action"`
+	Office string `json:"office"`
+	// Two letter hazard code, e.g. TO (tornado), SV (severe thunderstorm), FF (flash flood)
+	Phenomena string `json:"phenomena"`
+	// W (warning), A (watch), Y (advisory), S (statement), F (forecast), O (outlook) or N (synopsis)
+	Significance string `json:"significance"`
+	// Event tracking number
+	ETN int `json:"etn"`
+	// Zero if the event has already begun, or continues until further notice
+	Begin time.Time `json:"begin"`
+	End   time.Time `json:"end"`
+	Raw   string    `json:"raw"`
+}
+
+var vtecRe = regexp.MustCompile(`/([OTEX])\.([A-Z]{3})\.([A-Z]{4})\.([A-Z]{2})\.([WAYSFON])\.([0-9]{4})\.([0-9]{6}T[0-9]{4}Z)-([0-9]{6}T[0-9]{4}Z)/`)
+
+// Finds every P-VTEC string in text
+func ParseVTEC(text string) []VTEC {
+	var ret []VTEC
+	for _, m := range vtecRe.FindAllStringSubmatch(text, -1) {
+		etn, _ := strconv.Atoi(m[6])
+		ret = append(ret, VTEC{
+			Class:        m[1],
+			Action:       m[2],
+			Office:       m[3],
+			Phenomena:    m[4],
+			Significance: m[5],
+			ETN:          etn,
+			Begin:        vtecTime(m[7]),
+			End:          vtecTime(m[8]),
+			Raw:          m[0],
+		})
+	}
+	return ret
+}
+
+func vtecTime(s string) time.Time {
+	if s == "000000T0000Z" {
+		return time.Time{}
+	}
+	t, err := time.Parse("060102T1504Z", s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// Identifies the event across updates, e.g. KOAX.TO.W.0012
+func (v VTEC) EventID() string {
+	return fmt.Sprintf("%s.%s.%s.%04d", v.Office, v.Phenomena, v.Significance, v.ETN)
+}
+
+// Whether the event is in effect at the given time
+func (v VTEC) Active(now time.Time) bool {
+	if v.Action == "CAN" || v.Action == "EXP" {
+		return false
+	}
+	if !v.Begin.IsZero() && now.Before(v.Begin) {
+		return false
+	}
+	return v.End.IsZero() || now.Before(v.End)
+}
+
+// UGC (Universal Geographic Code) group: the zones or counties a product segment applies to, and when it expires
+type UGC struct {
+	// e.g. NEZ050 for a forecast zone, NEC055 for a county
+	Codes   []string  `json:"codes"`
+	Expires time.Time `json:"expires"`
+	Raw     string    `json:"raw"`
+}
+
+var (
+	ugcStartRe = regexp.MustCompile(`^[A-Z]{2}[CZ]([0-9]{3}|ALL)[->]`)
+	ugcCodeRe  = regexp.MustCompile(`^(?:([A-Z]{2}[CZ]))?([0-9]{3}|ALL)(?:>([0-9]{3}))?$`)
+	ugcTimeRe  = regexp.MustCompile(`^[0-9]{6}$`)
+)
+
+// Finds every UGC group in text. A group can run over several lines, and ends with its DDHHMM expiry time
+func ParseUGC(text string, ref time.Time) []UGC {
+	var ret []UGC
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if !ugcStartRe.MatchString(line) {
+			continue
+		}
+
+		raw := line
+		for !ugcEnds(raw) && i+1 < len(lines) {
+			i++
+			raw += strings.TrimSpace(lines[i])
+		}
+		if ugc, err := parseUGCGroup(raw, ref); err == nil {
+			ret = append(ret, ugc)
+		}
+	}
+	return ret
+}
+
+func ugcEnds(raw string) bool {
+	parts := strings.Split(strings.TrimSuffix(raw, "-"), "-")
+	return strings.HasSuffix(raw, "-") && ugcTimeRe.MatchString(parts[len(parts)-1])
+}
+
+func parseUGCGroup(raw string, ref time.Time) (UGC, error) {
+	ugc := UGC{Raw: raw}
+	parts := strings.Split(strings.TrimSuffix(raw, "-"), "-")
+	if len(parts) < 2 || !ugcTimeRe.MatchString(parts[len(parts)-1]) {
+		return ugc, fmt.Errorf("UGC group has no expiry time: %s", raw)
+	}
+
+	var err error
+	if ugc.Expires, err = resolveDayTime(parts[len(parts)-1], ref, false); err != nil {
+		return ugc, err
+	}
+
+	prefix := ""
+	for _, p := range parts[:len(parts)-1] {
+		m := ugcCodeRe.FindStringSubmatch(p)
+		if m == nil {
+			return ugc, fmt.Errorf("Invalid UGC code %q in %s", p, raw)
+		}
+		if m[1] != "" {
+			prefix = m[1]
+		}
+		if prefix == "" {
+			return ugc, fmt.Errorf("UGC code %q has no state", p)
+		}
+
+		if m[2] == "ALL" || m[3] == "" {
+			ugc.Codes = append(ugc.Codes, prefix+m[2])
+			continue
+		}
+		from, _ := strconv.Atoi(m[2])
+		to, _ := strconv.Atoi(m[3])
+		for n := from; n <= to; n++ {
+			ugc.Codes = append(ugc.Codes, fmt.Sprintf("%s%03d", prefix, n))
+		}
+	}
+	return ugc, nil
+}
+
+// Whether the group covers the given zone or county code. Codes ending in ALL cover every zone in the state
+func (u UGC) Covers(code string) bool {
+	code = strings.ToUpper(code)
+	for _, c := range u.Codes {
+		if c == code || (strings.HasSuffix(c, "ALL") && len(code) == 6 && c[:3] == code[:3]) {
+			return true
+		}
+	}
+	return false
+}
@@ -5,7 +5,6 @@ go 1.24.11
 require (
 	github.com/charmbracelet/log v0.4.2
 	github.com/knadh/koanf/v2 v2.3.0
-	github.com/opensatelliteproject/goaec v0.0.0-20190224065807-d814e01b69fa
 	github.com/opensatelliteproject/libsathelper v0.0.0-20201213205030-0c5ee163b540
 	github.com/racerxdl/segdsp v0.0.0-20190825170906-a855d00a24a8
 	gonum.org/v1/gonum v0.16.0
@@ -6,35 +6,15 @@ import (
 	"time"
 
 	"github.com/charmbracelet/log"
+	"github.com/jrwynneiii/ccsds_tools/mission"
+	"github.com/jrwynneiii/ccsds_tools/packets"
 	"github.com/jrwynneiii/ccsds_tools/types"
 	SatHelper "github.com/opensatelliteproject/libsathelper"
 )
 
-var VCIDs = map[int]string{
-	0:  "Admin Text",
-	1:  "Mesoscale",
-	2:  "Visual",
-	6:  "GOES-ABI",
-	7:  "Shortwave IR",
-	8:  "Mid-Level Water Vapor",
-	9:  "Upper-Level Water Vapor",
-	13: "Clean Long-Wave IR",
-	14: "IR Long-Wave",
-	15: "Dirty Long-Wave IR",
-	17: "Partner GOES-R - Clean Long-Wave IR",
-	20: "EMWIN - High Priority",
-	21: "EMWIN - Graphics",
-	22: "EMWIN - Low Priority",
-	23: "GOES-ABI",
-	24: "NHC Maritime Graphics",
-	25: "Misc GOES Graphics",
-	26: "INTL",
-	30: "DCS Admin",
-	31: "DCS",
-	32: "DCS (New Format)",
-	60: "Himawari",
-	63: "IDLE",
-}
+// VCID names for GOES-R HRIT. Kept for existing users; other missions should use Decoder.VCIDNames, which is set
+// from the selected mission profile
+var VCIDs = mission.GOESRHRIT.VCIDs
 
 type Decoder struct {
 	TotalFramesProcessed     int
@@ -43,7 +23,7 @@ type Decoder struct {
 	StatsMutex               sync.RWMutex
 	FrameLock                bool
 	SymbolsInput             *chan byte
-	FramesOutput             *chan []byte
+	FramesOutput             *chan packets.Frame
 	MaxVitErrors             int
 	ViterbiBytes             []byte
 	DecodedBytes             []byte
@@ -70,10 +50,22 @@ type Decoder struct {
 	AverageRsCorrections     float64
 	AvgVitCorrections        float32
 	SigQuality               float32
+	PacketFixer              SatHelper.PacketFixer
+	Phase                    PhaseState
+	PhaseChanges             int
+	NRZMDecode               bool
+	Workers                  int
+	VCIDNames                map[int]string
+	FrameVCID                func(data []byte) uint8 // Pulls the VCID out of a frame, for the per channel stats
 
 	lastFrameOk         bool
 	recheckCounter      int
 	currentFrameCorrupt bool
+	correlatorLocked    bool
+	quit                chan struct{}
+	stopOnce            sync.Once
+	correlation         uint
+	rsErrors            []int
 }
 
 func (d *Decoder) Flush() {
@@ -98,8 +90,15 @@ func (d *Decoder) Reset() {
 	d.RxPacketsPerChannel = make(map[int]int)
 	d.DroppedPacketsPerChannel = make(map[int]int)
 	d.TotalFramesProcessed = 0
+	d.Phase = PhaseState{}
+	d.PhaseChanges = 0
 }
+
+// Stops Start(), and the worker pool if there is one
 func (d *Decoder) Destroy() {
+	d.stopOnce.Do(func() {
+		close(d.quit)
+	})
 }
 func (d *Decoder) Close() {
 }
@@ -109,10 +108,10 @@ func (d *Decoder) clearBuffers() {
 	d.DecodedBytes = make([]byte, len(d.DecodedBytes))
 	d.EncodedBytes = make([]byte, len(d.EncodedBytes))
 	d.RSWorkBuffer = make([]byte, 255)
-	d.RSCorrectedData = make([]byte, len(d.RSCorrectedData))
+	d.RSCorrectedData = make([]byte, d.FrameSize)
 }
 
-func New(bufsize uint, vitConf types.ViterbiConf, xritConf types.XRITFrameConf, input *chan byte, output *chan []byte) *Decoder {
+func New(bufsize uint, vitConf types.ViterbiConf, xritConf types.XRITFrameConf, input *chan byte, output *chan packets.Frame) *Decoder {
 	frameSizeBits := xritConf.FrameSize * 8
 	encodedFrameSize := frameSizeBits * 2
 	LastFrameSizeBits := xritConf.LastFrameSize * 8
@@ -137,6 +136,11 @@ func New(bufsize uint, vitConf types.ViterbiConf, xritConf types.XRITFrameConf,
 		LastFrameSizeBytes:       xritConf.LastFrameSize,
 		ReedSolomon:              SatHelper.NewReedSolomon(),
 		Correlator:               SatHelper.NewCorrelator(),
+		PacketFixer:              SatHelper.NewPacketFixer(),
+		NRZMDecode:               !xritConf.DisableNRZM,
+		Workers:                  xritConf.DecodeWorkers,
+		VCIDNames:                VCIDs,
+		FrameVCID:                packets.AOSVCID,
 		EncodedFrameSize:         encodedFrameSize,
 		MaxRecheckThreshold:      100,
 		MinCorrelationBits:       46,
@@ -150,6 +154,7 @@ func New(bufsize uint, vitConf types.ViterbiConf, xritConf types.XRITFrameConf,
 		lastFrameOk:              false,
 		recheckCounter:           0,
 		currentFrameCorrupt:      false,
+		quit:                     make(chan struct{}),
 	}
 
 	for i := 0; i < d.LastFrameSizeBits; i++ {
@@ -161,13 +166,23 @@ func New(bufsize uint, vitConf types.ViterbiConf, xritConf types.XRITFrameConf,
 
 	// Prime the correlator
 	// See https://lucasteske.dev/2017/01/goes-16-in-the-house/#syncing-data-and-viterbi for reasoning.
-	// The correlator will sync up our frames correctly
-	d.Correlator.AddWord(uint64(0xfc4ef4fd0cc2df89))
-	d.Correlator.AddWord(uint64(0x25010b02f33d2076))
+	// The correlator will sync up our frames correctly, and tell us which phase/IQ state the frame arrived in
+	if xritConf.SyncWord0Deg != 0 || xritConf.SyncWord180Deg != 0 {
+		d.addSyncWords(xritConf.SyncWord0Deg, xritConf.SyncWord180Deg)
+	} else {
+		d.addSyncWords(SyncWord0Deg, SyncWord180Deg)
+	}
 
 	return &d
 }
 
+func (d *Decoder) VCIDName(vcid int) string {
+	if name, ok := d.VCIDNames[vcid]; ok {
+		return name
+	}
+	return fmt.Sprintf("VCID %d", vcid)
+}
+
 func (d *Decoder) GetOutput() any {
 	return d.FramesOutput
 }
@@ -186,6 +201,7 @@ func (d *Decoder) checkIfFrameLocked() {
 	// Use the correlator to see where the sync words are in the frame, such that we know where the packet starts
 	// If we're not frame locked, or we've gotten a lot of good packets and should make sure were on the right
 	// track and not out of sync, then try to recorrelate, otherwise, don't try and recorrelate the whole frame
+	d.correlatorLocked = false
 	if !d.lastFrameOk || d.recheckCounter >= d.MaxRecheckThreshold {
 		d.Correlator.Correlate(&d.EncodedBytes[0], uint(d.EncodedFrameSize))
 		d.recheckCounter = 0
@@ -197,6 +213,8 @@ func (d *Decoder) checkIfFrameLocked() {
 			//Lost lock, so lets recorrelate the whole frame
 			d.Correlator.Correlate(&d.EncodedBytes[0], uint(d.EncodedFrameSize))
 			d.recheckCounter = 0
+		} else {
+			d.correlatorLocked = true
 		}
 	}
 	d.recheckCounter++
@@ -204,7 +222,8 @@ func (d *Decoder) checkIfFrameLocked() {
 
 func (d *Decoder) correlate() error {
 	// Check to make sure we actually got enough data that contains a packet/frame
-	if correlation := d.Correlator.GetHighestCorrelation(); correlation < d.MinCorrelationBits {
+	d.correlation = d.Correlator.GetHighestCorrelation()
+	if d.correlation < d.MinCorrelationBits {
 		d.lastFrameOk = false
 		return fmt.Errorf("No packet lock")
 	}
@@ -265,10 +284,12 @@ func (d *Decoder) errorCorrectPacket() {
 	//Reed Solomon Time
 	derrors := make([]int32, d.RsBlocks)
 	totalBytesFixed := int32(0)
+	d.rsErrors = make([]int, d.RsBlocks)
 
 	for i := 0; i < int(d.RsBlocks); i++ {
 		d.ReedSolomon.Deinterleave(&d.DecodedBytes[0], &d.RSWorkBuffer[0], byte(i), d.RsBlocks)
 		derrors[i] = int32(int8(d.ReedSolomon.Decode_ccsds(&d.RSWorkBuffer[0])))
+		d.rsErrors[i] = int(derrors[i])
 
 		d.ReedSolomon.Interleave(&d.RSWorkBuffer[0], &d.RSCorrectedData[0], byte(i), d.RsBlocks)
 
@@ -294,14 +315,69 @@ func (d *Decoder) stripRSDataFromFrame() {
 	d.RSCorrectedData = d.RSCorrectedData[:d.FrameSize-d.RSParityBlockSize-d.SyncWordSize]
 }
 
+// Calculate our 'signal quality' percentage based upon the bit error rate
+func (d *Decoder) updateSignalQuality(BER int) {
+	d.StatsMutex.Lock()
+	d.SigQuality = 100 * ((float32(d.MaxVitErrors) - float32(BER)) / float32(d.MaxVitErrors))
+	if d.SigQuality > 100 {
+		d.SigQuality = 100
+	} else if d.SigQuality < 0 {
+		d.SigQuality = 0
+	}
+	d.StatsMutex.Unlock()
+}
+
+func (d *Decoder) outputFrame(frame packets.Frame, corrupt bool) {
+	if len(frame.Data) != 892 {
+		log.Errorf("Incorrect frame size: Have: %d Want: 892", len(frame.Data))
+	}
+
+	d.StatsMutex.Lock()
+	d.TotalFramesProcessed++
+	d.StatsMutex.Unlock()
+
+	// Virtual Channel ID
+	vcid := d.FrameVCID(frame.Data)
+	//counter := (uint32(frame.Data[2]) << 16) | (uint32(frame.Data[3]) << 8) | uint32(frame.Data[4])
+
+	if !corrupt {
+		d.StatsMutex.Lock()
+		d.FrameLock = true
+		d.StatsMutex.Unlock()
+
+		*d.FramesOutput <- frame
+
+		d.StatsMutex.Lock()
+		d.RxPacketsPerChannel[int(vcid)]++
+		d.StatsMutex.Unlock()
+	} else {
+		d.StatsMutex.Lock()
+		d.DroppedPacketsPerChannel[int(vcid)]++
+		d.FrameLock = false
+		d.StatsMutex.Unlock()
+	}
+}
+
 func (d *Decoder) Start() {
+	if d.Workers > 1 {
+		d.startParallel()
+		return
+	}
+
 	for {
+		select {
+		case <-d.quit:
+			return
+		default:
+		}
+
 		//This is the meat and potatoes here. We should get our BER, SNR, and Sync status here
 		if len(*d.SymbolsInput) >= d.EncodedFrameSize {
 			//Grab a frame's worth of symbols
 			for i := 0; i < d.EncodedFrameSize; i++ {
 				d.EncodedBytes[i] = <-*d.SymbolsInput
 			}
+			receivedAt := time.Now()
 
 			//Do we have frame sync?
 			d.checkIfFrameLocked()
@@ -312,23 +388,20 @@ func (d *Decoder) Start() {
 				continue
 			}
 
+			//Undo any phase ambiguity or IQ swap left over from carrier recovery
+			d.fixPhase()
+
 			//Decode convolutional encoding
 			d.convolutionalDecode()
 
-			//Now lets do the differential decode
-			SatHelper.DifferentialEncodingNrzmDecode(&d.DecodedBytes[0], d.FrameSize+d.LastFrameSizeBytes)
+			//Now lets do the differential decode, if the mission uses it
+			if d.NRZMDecode {
+				SatHelper.DifferentialEncodingNrzmDecode(&d.DecodedBytes[0], d.FrameSize+d.LastFrameSizeBytes)
+			}
 
 			BER := d.calculateBitErrorRate()
 
-			// Calculate our 'signal quality' percentage based upon the bit error rate
-			d.StatsMutex.Lock()
-			d.SigQuality = 100 * ((float32(d.MaxVitErrors) - float32(BER)) / float32(d.MaxVitErrors))
-			if d.SigQuality > 100 {
-				d.SigQuality = 100
-			} else if d.SigQuality < 0 {
-				d.SigQuality = 0
-			}
-			d.StatsMutex.Unlock()
+			d.updateSignalQuality(BER)
 
 			d.cleanFrame()
 
@@ -338,34 +411,17 @@ func (d *Decoder) Start() {
 
 			d.stripRSDataFromFrame()
 
-			if len(d.RSCorrectedData) != 892 {
-				log.Errorf("Incorrect frame size: Have: %d Want: 892", len(d.RSCorrectedData))
-			}
-
-			d.StatsMutex.Lock()
-			d.TotalFramesProcessed++
-			d.StatsMutex.Unlock()
-
-			// Virtual Channel ID
-			vcid := d.RSCorrectedData[1] & 0x3F
-			//counter := (uint32(d.RSCorrectedData[2]) << 16) | (uint32(d.RSCorrectedData[3]) << 8) | uint32(d.RSCorrectedData[4])
-
-			if !d.currentFrameCorrupt {
-				d.StatsMutex.Lock()
-				d.FrameLock = true
-				d.StatsMutex.Unlock()
-
-				*d.FramesOutput <- d.RSCorrectedData
-
-				d.StatsMutex.Lock()
-				d.RxPacketsPerChannel[int(vcid)]++
-				d.StatsMutex.Unlock()
-			} else {
-				d.StatsMutex.Lock()
-				d.DroppedPacketsPerChannel[int(vcid)]++
-				d.FrameLock = false
-				d.StatsMutex.Unlock()
+			frame := packets.Frame{
+				Data: d.RSCorrectedData,
+				Quality: packets.FrameQuality{
+					ReceivedAt:       receivedAt,
+					ViterbiBER:       BER,
+					RSCorrections:    d.rsErrors,
+					CorrelationScore: d.correlation,
+					FrameLock:        d.correlatorLocked,
+				},
 			}
+			d.outputFrame(frame, d.currentFrameCorrupt)
 
 			d.clearBuffers()
 
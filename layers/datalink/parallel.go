@@ -0,0 +1,192 @@
+package datalink
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jrwynneiii/ccsds_tools/packets"
+	SatHelper "github.com/opensatelliteproject/libsathelper"
+)
+
+// A frameJob is a single correlated, phase corrected frame's worth of encoded symbols, along with the tail of the
+// previous frame. Since the viterbi overlap only depends on the previous frame's *encoded* symbols, each job can be
+// decoded independently of the others
+type frameJob struct {
+	seq           uint64
+	symbols       []byte
+	frame         []byte
+	corrupt       bool
+	ber           int
+	rsCorrections float64
+	rsErrors      []int
+	receivedAt    time.Time
+	correlation   uint
+	locked        bool
+}
+
+// Each worker is a stripped down Decoder with its own buffers, viterbi decoder and RS decoder, so that we can reuse
+// the same decode steps as the serial path
+func (d *Decoder) newWorker() *Decoder {
+	w := Decoder{
+		ViterbiBytes:       make([]byte, len(d.ViterbiBytes)),
+		DecodedBytes:       make([]byte, len(d.DecodedBytes)),
+		LastFrameEnd:       make([]byte, len(d.LastFrameEnd)),
+		EncodedBytes:       make([]byte, len(d.EncodedBytes)),
+		SyncWord:           make([]byte, len(d.SyncWord)),
+		RSWorkBuffer:       make([]byte, 255),
+		RSCorrectedData:    make([]byte, d.FrameSize),
+		Viterbi:            SatHelper.NewViterbi27(d.FrameSize*8 + d.LastFrameSizeBits),
+		MaxVitErrors:       d.MaxVitErrors,
+		LastFrameSizeBits:  d.LastFrameSizeBits,
+		LastFrameSizeBytes: d.LastFrameSizeBytes,
+		ReedSolomon:        SatHelper.NewReedSolomon(),
+		NRZMDecode:         d.NRZMDecode,
+		EncodedFrameSize:   d.EncodedFrameSize,
+		FrameSize:          d.FrameSize,
+		SyncWordSize:       d.SyncWordSize,
+		RsBlocks:           d.RsBlocks,
+		RSParityBlockSize:  d.RSParityBlockSize,
+		RSParitySize:       d.RSParitySize,
+	}
+	w.ReedSolomon.SetCopyParityToOutput(true)
+	return &w
+}
+
+func (w *Decoder) decodeJob(job *frameJob) {
+	copy(w.ViterbiBytes, job.symbols)
+	w.Viterbi.Decode(&w.ViterbiBytes[0], &w.DecodedBytes[0])
+
+	if w.NRZMDecode {
+		SatHelper.DifferentialEncodingNrzmDecode(&w.DecodedBytes[0], w.FrameSize+w.LastFrameSizeBytes)
+	}
+
+	job.ber = w.calculateBitErrorRate()
+
+	w.cleanFrame()
+
+	SatHelper.DeRandomizerDeRandomize(&w.DecodedBytes[0], w.FrameSize-w.SyncWordSize)
+
+	w.errorCorrectPacket()
+
+	w.stripRSDataFromFrame()
+
+	job.frame = w.RSCorrectedData
+	job.corrupt = w.currentFrameCorrupt
+	job.rsCorrections = w.AverageRsCorrections
+	job.rsErrors = w.rsErrors
+
+	w.clearBuffers()
+}
+
+// Collects decoded frames from the workers, and puts them back in the order they were received before sending
+// them on to the transport layer
+func (d *Decoder) collectFrames(results chan *frameJob) {
+	pending := make(map[uint64]*frameJob)
+	next := uint64(0)
+	for job := range results {
+		pending[job.seq] = job
+		for {
+			job, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+
+			d.StatsMutex.Lock()
+			d.AvgVitCorrections += float32(job.ber)
+			if !job.corrupt {
+				d.AverageRsCorrections = job.rsCorrections
+			}
+			d.StatsMutex.Unlock()
+
+			d.updateSignalQuality(job.ber)
+			frame := packets.Frame{
+				Data: job.frame,
+				Quality: packets.FrameQuality{
+					ReceivedAt:       job.receivedAt,
+					ViterbiBER:       job.ber,
+					RSCorrections:    job.rsErrors,
+					CorrelationScore: job.correlation,
+					FrameLock:        job.locked,
+				},
+			}
+			d.outputFrame(frame, job.corrupt)
+		}
+	}
+}
+
+// Correlation and phase correction are done serially, since they decide where each frame begins. Everything after
+// that (viterbi, NRZ-M, derandomization and RS) is handed off to a pool of workers.
+//
+// Unlike the serial path, the RS result can't decide whether the next frame is recorrelated in full: by the time a
+// worker has decoded a frame, up to 2*Workers later frames have already been sliced. Lock is judged from the sync
+// word instead, so a frame that correlates below MinCorrelationBits is recorrelated straight away
+func (d *Decoder) startParallel() {
+	jobs := make(chan *frameJob, d.Workers*2)
+	results := make(chan *frameJob, d.Workers*2)
+
+	var workers sync.WaitGroup
+	for i := 0; i < d.Workers; i++ {
+		w := d.newWorker()
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for job := range jobs {
+				w.decodeJob(job)
+				results <- job
+			}
+		}()
+	}
+	go d.collectFrames(results)
+	// Once Destroy() is called, the workers finish what they have, then the collector sends on the last frames
+	defer func() {
+		close(jobs)
+		go func() {
+			workers.Wait()
+			close(results)
+		}()
+	}()
+
+	seq := uint64(0)
+	for {
+		select {
+		case <-d.quit:
+			return
+		default:
+		}
+		if len(*d.SymbolsInput) < d.EncodedFrameSize {
+			time.Sleep(5 * time.Microsecond)
+			continue
+		}
+
+		//Grab a frame's worth of symbols
+		for i := 0; i < d.EncodedFrameSize; i++ {
+			d.EncodedBytes[i] = <-*d.SymbolsInput
+		}
+		receivedAt := time.Now()
+
+		d.checkIfFrameLocked()
+		if err := d.correlate(); err != nil {
+			continue
+		}
+		d.lastFrameOk = true
+
+		d.fixPhase()
+
+		// Prepend the tail of the last frame's encoded symbols, same as convolutionalDecode()
+		job := frameJob{
+			seq:         seq,
+			symbols:     make([]byte, d.LastFrameSizeBits+d.EncodedFrameSize),
+			receivedAt:  receivedAt,
+			correlation: d.correlation,
+			locked:      d.correlatorLocked,
+		}
+		copy(job.symbols[:d.LastFrameSizeBits], d.LastFrameEnd[:d.LastFrameSizeBits])
+		copy(job.symbols[d.LastFrameSizeBits:], d.EncodedBytes[:d.EncodedFrameSize])
+		copy(d.LastFrameEnd[:d.LastFrameSizeBits], job.symbols[d.EncodedFrameSize:d.EncodedFrameSize+d.LastFrameSizeBits])
+		seq++
+
+		jobs <- &job
+	}
+}
@@ -0,0 +1,78 @@
+package datalink
+
+import (
+	"fmt"
+
+	SatHelper "github.com/opensatelliteproject/libsathelper"
+)
+
+// Encoded GOES-R HRIT sync words, as seen after the rate 1/2 convolutional encoder.
+// See https://lucasteske.dev/2017/01/goes-16-in-the-house/#syncing-data-and-viterbi
+const (
+	SyncWord0Deg   uint64 = 0xfc4ef4fd0cc2df89
+	SyncWord180Deg uint64 = 0x25010b02f33d2076
+)
+
+// PhaseState describes the symbol correction applied to a frame before it is handed to the viterbi decoder.
+// BPSK carrier recovery leaves a 180 degree ambiguity, and some receivers swap the I and Q branches; both
+// show up as a different correlator word matching the frame.
+type PhaseState struct {
+	PhaseShift int
+	IQSwapped  bool
+}
+
+// The order here must match the order that the words are added to the correlator in addSyncWords()
+var correlatorWordPhases = []PhaseState{
+	{PhaseShift: 0, IQSwapped: false},
+	{PhaseShift: 180, IQSwapped: false},
+	{PhaseShift: 0, IQSwapped: true},
+	{PhaseShift: 180, IQSwapped: true},
+}
+
+func (p PhaseState) String() string {
+	if p.IQSwapped {
+		return fmt.Sprintf("%d° (IQ swapped)", p.PhaseShift)
+	}
+	return fmt.Sprintf("%d°", p.PhaseShift)
+}
+
+func (p PhaseState) satHelperPhaseShift() SatHelper.SatHelperPhaseShift {
+	if p.PhaseShift == 180 {
+		return SatHelper.DEG_180
+	}
+	return SatHelper.DEG_0
+}
+
+// Swaps each pair of symbols within an encoded sync word. This is what the word looks like when the I and Q
+// branches have been swapped
+func swapIQ(word uint64) uint64 {
+	return ((word & 0xaaaaaaaaaaaaaaaa) >> 1) | ((word & 0x5555555555555555) << 1)
+}
+
+func (d *Decoder) addSyncWords(word0 uint64, word180 uint64) {
+	d.Correlator.AddWord(word0)
+	d.Correlator.AddWord(word180)
+	d.Correlator.AddWord(swapIQ(word0))
+	d.Correlator.AddWord(swapIQ(word180))
+}
+
+// Looks at which of the correlator words matched the current frame, and rotates/swaps the encoded symbols so that
+// the viterbi decoder always sees a 0 degree, non-swapped frame
+func (d *Decoder) fixPhase() {
+	word := int(d.Correlator.GetCorrelationWordNumber())
+	if word >= len(correlatorWordPhases) {
+		word = 0
+	}
+	state := correlatorWordPhases[word]
+
+	d.StatsMutex.Lock()
+	if state != d.Phase {
+		d.PhaseChanges++
+		d.Phase = state
+	}
+	d.StatsMutex.Unlock()
+
+	if state.PhaseShift != 0 || state.IQSwapped {
+		d.PacketFixer.FixPacket(&d.EncodedBytes[0], uint(d.EncodedFrameSize), state.satHelperPhaseShift(), state.IQSwapped)
+	}
+}
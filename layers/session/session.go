@@ -4,18 +4,22 @@ import (
 	"time"
 
 	"github.com/charmbracelet/log"
+	"github.com/jrwynneiii/ccsds_tools/admin"
 	"github.com/jrwynneiii/ccsds_tools/lrit"
 )
 
 type LRITGen struct {
 	TransportInput *chan lrit.File
 	LRITOutput     *chan *lrit.File
+	// Admin text messages seen on VCID 0. Register with AdminMessages.OnMessage() to hear about new ones
+	AdminMessages *admin.History
 }
 
 func New(input *chan lrit.File, output *chan *lrit.File) *LRITGen {
 	return &LRITGen{
 		TransportInput: input,
 		LRITOutput:     output,
+		AdminMessages:  admin.NewHistory(100),
 	}
 }
 
@@ -37,8 +41,11 @@ func (l *LRITGen) ProcessTransportFile(lf *lrit.File) {
 			log.Error(err)
 			return
 		case lrit.LRITLengthMismatchErr:
-			log.Errorf("(%s) %s. Have: %d, Want: %d", lf.GetName(), err.Error(), len(lf.Data), lf.PrimaryHeader.DataLength/8)
-			return
+			if !lf.Incomplete {
+				log.Errorf("(%s) %s. Have: %d, Want: %d", lf.GetName(), err.Error(), len(lf.Data), lf.PrimaryHeader.DataLength/8)
+				return
+			}
+			log.Warnf("LRIT file %s is incomplete (%.1f%%), passing it on anyway", lf.GetName(), lf.Completeness)
 		case lrit.LRITCRCMismatchErr:
 			if lf.IsImageFile() {
 				log.Warnf("LRIT file %s has CRC mismatch, but attempting to continue...", lf.GetName())
@@ -54,6 +61,12 @@ func (l *LRITGen) ProcessTransportFile(lf *lrit.File) {
 		return
 	}
 
+	if l.AdminMessages != nil {
+		if m, isNew := l.AdminMessages.Process(lf); isNew {
+			log.Infof("New admin message: %s", m.Title)
+		}
+	}
+
 	*l.LRITOutput <- lf
 }
 
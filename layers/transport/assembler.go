@@ -3,6 +3,7 @@ package transport
 import (
 	"fmt"
 	"sort"
+	"sync"
 
 	"github.com/charmbracelet/log"
 	"github.com/jrwynneiii/ccsds_tools/lrit"
@@ -12,16 +13,55 @@ import (
 type TransportAssembler struct {
 	lastVCDUCounter uint32
 	lastSDU         []byte
+	lastSDUQuality  packets.QualitySummary
 	lastVCDU        *packets.VCDU
 	APIDs           map[uint16][]*packets.MSDU
 	Files           map[uint16]*lrit.File
 	TransportOutput *chan lrit.File
 	VCID            uint8
 	lastAppliedSDU  map[uint16]*packets.MSDU
+	Parser          FrameParser
+
+	// If set, every space packet (CP_PDU) is sent here as well, once its CRC has been checked. Packets are dropped,
+	// and counted in DroppedPackets, if the channel is full
+	PacketOutput *chan packets.MSDU
+	// If false, packets are not reassembled into LRIT files
+	AssembleFiles bool
+	// Custom handlers by APID. These take the place of LRIT reassembly for that APID
+	Handlers map[uint16]PacketHandler
+	// Time code formats by APID
+	TimeCodes map[uint16]packets.TimeCodeFormat
+	Policy    AssemblyPolicy
+	Eviction  EvictionPolicy
+
+	ReplayPolicy   ReplayPolicy
+	replay         *TransportAssembler
+	recentFrames   map[uint32]uint64
+	recentCounters []uint32
+	lastStale      uint32
+	staleRun       int
+
+	statsMutex      sync.RWMutex
+	MissedFrames    int
+	DuplicateFrames int
+	ReplayFrames    int
+	DroppedPackets  int
+	QueueOverflows  int
+	StaleFrames     int
+	files           []FileProgress
+}
+
+// How the assembler deals with corrupt or missing SDUs
+type AssemblyPolicy struct {
+	// Keep SDUs that fail their CRC check, and flag the file as corrupt, rather than dropping the file
+	ContinueOnCRCFailure bool
+	// What to fill missing image rows with
+	Fill lrit.FillPolicy
 }
 
 func NewTransportAssembler(output *chan lrit.File, vcid uint8) *TransportAssembler {
 	return &TransportAssembler{
+		AssembleFiles:   true,
 		lastVCDUCounter: 0,
 		lastSDU:         []byte{},
 		lastVCDU:        nil,
@@ -30,6 +70,10 @@ func NewTransportAssembler(output *chan lrit.File, vcid uint8) *TransportAssembl
 		TransportOutput: output,
 		VCID:            vcid,
 		lastAppliedSDU:  make(map[uint16]*packets.MSDU),
+		Handlers:        make(map[uint16]PacketHandler),
+		TimeCodes:       make(map[uint16]packets.TimeCodeFormat),
+		recentFrames:    make(map[uint32]uint64),
+		Parser:          NewAOSFrameParser(),
 	}
 }
 
@@ -49,13 +93,15 @@ func (t *TransportAssembler) processAnySkippedSDU(apid uint16, sdu *packets.MSDU
 				if t.Files[apid].SecondaryHeadersPopulated && t.Files[apid].IsImageFile() {
 					ish, _ = t.Files[apid].GetImageStructureHeader()
 					if ish != (lrit.ImageStructureHeader{}) {
-						if diff > uint(t.Files[apid].MissingRows()) {
-							log.Error("Dropping file %s, due to skipped end rows", t.Files[apid].GetName())
+						if uint64(diff)*uint64(t.Files[apid].RowsPerPacket()) > t.Files[apid].MissingRows() {
+							log.Errorf("Dropping file %s, due to skipped end rows", t.Files[apid].GetName())
 							t.Drop(apid)
 						} else {
-							for i := uint(0); i < diff; i++ {
-								log.Infof("Filling missing packets...")
-								t.Files[apid].RawData = append(t.Files[apid].RawData, t.Files[apid].GetFillRow()...)
+							log.Infof("Filling %d missing packets...", diff)
+							if err := t.Files[apid].FillPackets(int(diff)); err != nil {
+								log.Error(err)
+								t.Drop(apid)
+								return
 							}
 						}
 					}
@@ -73,88 +119,134 @@ func (t *TransportAssembler) ProcessAllAPIDs() {
 		sort.Slice(sdus, func(a, b int) bool {
 			return sdus[a].Header.PacketSequenceCounter < sdus[b].Header.PacketSequenceCounter
 		})
+		handler, handled := t.Handlers[apid]
+		hasCRC := t.Parser.HasPacketCRC()
 		for _, sdu := range sdus {
-			if len(sdu.Data) < 2 {
+			if hasCRC && len(sdu.Data) < 2 {
 				continue
 			}
 
-			t.processAnySkippedSDU(apid, sdu)
+			if t.AssembleFiles && !handled {
+				t.processAnySkippedSDU(apid, sdu)
+			}
 			t.lastAppliedSDU[apid] = sdu
 
-			CRC := (uint16(sdu.Data[len(sdu.Data)-2]) << 8) | uint16(sdu.Data[len(sdu.Data)-1])
-			sdu.Data = sdu.Data[:len(sdu.Data)-2]
+			if hasCRC {
+				CRC := (uint16(sdu.Data[len(sdu.Data)-2]) << 8) | uint16(sdu.Data[len(sdu.Data)-1])
+				sdu.Data = sdu.Data[:len(sdu.Data)-2]
 
-			calcCRC := packets.CalcCRCBuffer(sdu.Data)
-			if calcCRC != CRC {
-				t.Drop(apid)
-				log.Error("CRC Mismatch")
-			} else {
-				sdu.CRCGood = true
-			}
-
-			switch sdu.Header.SequenceFlag {
-			case 0:
-				//Continuation of last packet
-				if t.Files[apid] != nil {
-					if err := t.Files[apid].Append(sdu); err != nil {
-						log.Error(err)
+				calcCRC := packets.CalcCRCBuffer(sdu.Data)
+				if calcCRC != CRC {
+					if t.AssembleFiles && !handled && !t.Policy.ContinueOnCRCFailure {
 						t.Drop(apid)
 					}
+					log.Error("CRC Mismatch")
+				} else {
+					sdu.CRCGood = true
 				}
-			case 1:
-				//Start new packet
-				//Clear out any existing file; like if we started and got garbage
-				t.Drop(apid)
-				var err error
-				if t.Files[apid], err = lrit.OpenNew(sdu); err != nil {
-					log.Error(err)
-				}
-			case 2:
-				//End packet
-				if t.Files[apid] != nil {
-					if err := t.Files[apid].Append(sdu); err != nil {
-						log.Error(err)
-						t.Drop(apid)
-						continue
-					}
-					if err := t.Files[apid].Close(); err != nil {
-						log.Error(err)
-						t.Drop(apid)
-						continue
-					}
+			} else {
+				sdu.CRCGood = true
+			}
+			t.decodeTime(apid, sdu)
 
-					*t.TransportOutput <- *t.Files[apid]
-					//Clear out the buffer
-					t.Drop(apid)
-				}
-			case 3:
-				//Self contained packet
-				t.Drop(apid)
-				var err error
-				if t.Files[apid], err = lrit.OpenNew(sdu); err != nil {
-					log.Error(err)
-					t.Drop(apid)
-					continue
-				}
+			if t.PacketOutput != nil {
+				t.sendPacket(sdu)
+			}
 
-				if err := t.Files[apid].Close(); err != nil {
-					log.Error(err)
-					t.Drop(apid)
-					continue
-				}
+			if handled {
+				handler(sdu)
+			} else if t.AssembleFiles {
+				t.assembleFile(apid, sdu)
+			}
+		}
+		delete(t.APIDs, apid)
+	}
+}
 
-				*t.TransportOutput <- *t.Files[apid]
+// Never blocks, so that a slow packet consumer can't hold up file reassembly
+func (t *TransportAssembler) sendPacket(sdu *packets.MSDU) {
+	select {
+	case *t.PacketOutput <- *sdu:
+	default:
+		t.statsMutex.Lock()
+		t.DroppedPackets++
+		t.statsMutex.Unlock()
+		log.Debugf("Packet output is full, dropping packet from APID %d on VCID %d", sdu.Header.APID, t.VCID)
+	}
+}
 
+// Folds an SDU into the LRIT file being built for its APID, and sends the file on once it's complete
+func (t *TransportAssembler) assembleFile(apid uint16, sdu *packets.MSDU) {
+	switch sdu.Header.SequenceFlag {
+	case 0:
+		//Continuation of last packet
+		if t.Files[apid] != nil {
+			if err := t.Files[apid].Append(sdu); err != nil {
+				log.Error(err)
 				t.Drop(apid)
-			default:
-				log.Errorf("Invalid sequence flag: %d", sdu.Header.SequenceFlag)
 			}
 		}
-		delete(t.APIDs, apid)
-		delete(t.lastAppliedSDU, apid)
+	case 1:
+		//Start new packet
+		//Clear out any existing file; like if we started and got garbage, or lost the end of the last file
+		if t.Files[apid] != nil {
+			t.evict(apid)
+		}
+		t.Drop(apid)
+		var err error
+		if t.Files[apid], err = lrit.OpenNew(sdu); err != nil {
+			log.Error(err)
+		} else {
+			t.applyPolicy(t.Files[apid])
+		}
+	case 2:
+		//End packet
+		if t.Files[apid] != nil {
+			if err := t.Files[apid].Append(sdu); err != nil {
+				log.Error(err)
+				t.Drop(apid)
+				return
+			}
+			if err := t.Files[apid].Close(); err != nil {
+				log.Error(err)
+				t.Drop(apid)
+				return
+			}
+
+			*t.TransportOutput <- *t.Files[apid]
+			//Clear out the buffer
+			t.Drop(apid)
+		}
+	case 3:
+		//Self contained packet
+		t.Drop(apid)
+		var err error
+		if t.Files[apid], err = lrit.OpenNew(sdu); err != nil {
+			log.Error(err)
+			t.Drop(apid)
+			return
+		}
+		t.applyPolicy(t.Files[apid])
+
+		if err := t.Files[apid].Close(); err != nil {
+			log.Error(err)
+			t.Drop(apid)
+			return
+		}
+
+		*t.TransportOutput <- *t.Files[apid]
+
+		t.Drop(apid)
+	default:
+		log.Errorf("Invalid sequence flag: %d", sdu.Header.SequenceFlag)
 	}
 }
 
+func (t *TransportAssembler) applyPolicy(f *lrit.File) {
+	f.ContinueOnCRCFailure = t.Policy.ContinueOnCRCFailure
+	f.Fill = t.Policy.Fill
+}
+
 func MakeMSDUHeader(data []byte) (packets.MSDUHeader, error) {
 	h := packets.MSDUHeader{}
 	if len(data) < 6 {
@@ -171,49 +263,90 @@ func MakeMSDUHeader(data []byte) (packets.MSDUHeader, error) {
 	return h, nil
 }
 
+// How many frames in a row have to count on from before the last frame before we believe the counter really went
+// backwards
+const staleResyncFrames = 16
+
+// Returns true for a frame from before the last one, i.e. a reordered frame or an old one that has fallen out of the
+// duplicate window. Counting forward from the last frame, it would look like a gap of most of the counter's range
+func (t *TransportAssembler) isStale(vcdu *packets.VCDU) bool {
+	if t.lastVCDU == nil {
+		return false
+	}
+	modulus := t.Parser.CounterModulus()
+	if packets.CounterDiff(modulus, t.lastVCDU.VCDUCounter, vcdu.VCDUCounter) <= uint(modulus/2) {
+		t.staleRun = 0
+		return false
+	}
+
+	if t.staleRun > 0 && packets.CounterDiff(modulus, t.lastStale, vcdu.VCDUCounter) == 1 {
+		t.staleRun++
+	} else {
+		t.staleRun = 1
+	}
+	t.lastStale = vcdu.VCDUCounter
+	if t.staleRun >= staleResyncFrames {
+		log.Warnf("VCDU counter on VCID %d went back from %d to %d", vcdu.VCID, t.lastVCDU.VCDUCounter, vcdu.VCDUCounter)
+		t.staleRun = 0
+		t.lastVCDU = nil
+		t.clearLastSDU()
+		return false
+	}
+
+	t.statsMutex.Lock()
+	t.StaleFrames++
+	t.statsMutex.Unlock()
+	log.Debugf("Dropping out of order VCDU on VCID %d. Last packet: %d, current packet: %d", vcdu.VCID, t.lastVCDU.VCDUCounter, vcdu.VCDUCounter)
+	return true
+}
+
 func (t *TransportAssembler) checkForSkippedVCDU(vcdu *packets.VCDU) error {
-	var err error
 	if t.lastVCDU != nil {
-		if packets.CounterDiff(1<<24, t.lastVCDU.VCDUCounter, vcdu.VCDUCounter) > 1 {
-			err = fmt.Errorf("Dropped VCDU found! Last packet: %d, current packet: %d", t.lastVCDU.VCDUCounter, vcdu.VCDUCounter)
-			if t.lastVCDU.VCDUCounter == vcdu.VCDUCounter && vcdu.VCDUVersion == t.lastVCDU.VCDUVersion {
-				err = fmt.Errorf("Duplicate VCDU found! Last packet: %d, current packet: %d", t.lastVCDU.VCDUCounter, vcdu.VCDUCounter)
-			}
+		if diff := packets.CounterDiff(t.Parser.CounterModulus(), t.lastVCDU.VCDUCounter, vcdu.VCDUCounter); diff > 1 {
+			t.statsMutex.Lock()
+			t.MissedFrames += int(diff - 1)
+			t.statsMutex.Unlock()
+			return fmt.Errorf("Dropped VCDU found on VCID %d! Last packet: %d, current packet: %d", vcdu.VCID, t.lastVCDU.VCDUCounter, vcdu.VCDUCounter)
 		}
 	}
-	return err
+	return nil
 }
 
 func (t *TransportAssembler) saveContinuationPacket(vcdu *packets.VCDU) {
 	if len(t.lastSDU) > 0 {
 		t.lastSDU = append(t.lastSDU, vcdu.Data...)
+		t.lastSDUQuality.Add(vcdu.Quality)
 	}
 	t.lastVCDU = vcdu
 }
 
-func (t *TransportAssembler) savePartialPacketEnd(fhp uint16, data []byte) []byte {
+func (t *TransportAssembler) savePartialPacketEnd(vcdu *packets.VCDU, data []byte) []byte {
+	fhp := vcdu.FirstHeaderOffset
 	if fhp > 0 && len(t.lastSDU) > 0 {
 		t.lastSDU = append(t.lastSDU, data[:fhp]...)
+		t.lastSDUQuality.Add(vcdu.Quality)
 	}
 	return data[fhp:]
 }
 
-func (t *TransportAssembler) ParseMSDUs(vcdu *packets.VCDU) error {
-	err := t.checkForSkippedVCDU(vcdu)
-	if err != nil {
-		//l.ClearIncompletePacketBufferByVCID(vcdu.VCID)
-		for apid, _ := range t.APIDs {
-			delete(t.APIDs, apid)
-		}
-		//if strings.Contains(err.Error(), "Duplicate VCDU found!") {
-		//	t.lastVCDU = vcdu
-		//	return err
-		//}
+func (t *TransportAssembler) clearLastSDU() {
+	t.lastSDU = []byte{}
+	t.lastSDUQuality = packets.QualitySummary{}
+}
 
+func (t *TransportAssembler) ParseMSDUs(vcdu *packets.VCDU) error {
+	if t.isStale(vcdu) {
+		return nil
+	}
+	if err := t.checkForSkippedVCDU(vcdu); err != nil {
+		// The only thing we know is lost is the packet that was straddling the gap. Any files in progress will
+		// notice their own missing SDUs by their sequence counters
+		t.clearLastSDU()
 		log.Error(err)
 	}
 
 	var ret []packets.MSDU
+	var err error
 
 	// If we get a packet without a header, just append all the data
 	if !vcdu.ContainsMSDUHeader() {
@@ -231,14 +364,13 @@ func (t *TransportAssembler) ParseMSDUs(vcdu *packets.VCDU) error {
 	}
 
 	// If we have some data before our first header, save it and shift
-	data = t.savePartialPacketEnd(vcdu.FirstHeaderOffset, data)
+	data = t.savePartialPacketEnd(vcdu, data)
 
 	// If we have enough for a header, lets go ahead and make one. If not, we probably missed somehting so drop it
 	if len(t.lastSDU) > 6 {
 		if header, err := MakeMSDUHeader(t.lastSDU); err != nil {
 			// Could not create a header for some reason, so lets bail
 			log.Error(err)
-			t.lastSDU = []byte{}
 		} else {
 			// If its not a fill cppdu
 			if !header.IsFillPacket() {
@@ -250,14 +382,14 @@ func (t *TransportAssembler) ParseMSDUs(vcdu *packets.VCDU) error {
 					VCDUCounter: t.lastVCDU.VCDUCounter,
 					VCDUReplay:  t.lastVCDU.VCDUReplay,
 					Data:        t.lastSDU[6:],
+					Quality:     t.lastSDUQuality,
 				}
 				ret = append(ret, c)
 			}
-			t.lastSDU = []byte{}
 		}
 	}
 
-	t.lastSDU = []byte{}
+	t.clearLastSDU()
 
 	for len(data) > 6 {
 		if header, err := MakeMSDUHeader(data); err != nil {
@@ -287,6 +419,7 @@ func (t *TransportAssembler) ParseMSDUs(vcdu *packets.VCDU) error {
 			if header.PacketLength > uint16(len(data)) {
 				//Save header and data
 				t.lastSDU = append(t.lastSDU, dataWithHeader...)
+				t.lastSDUQuality.Add(vcdu.Quality)
 				data = []byte{} // emptying data so that we don't accidentally save it again
 				break
 			}
@@ -300,6 +433,7 @@ func (t *TransportAssembler) ParseMSDUs(vcdu *packets.VCDU) error {
 				VCDUCounter: vcdu.VCDUCounter,
 				VCDUReplay:  vcdu.VCDUReplay,
 			}
+			c.Quality.Add(vcdu.Quality)
 
 			ret = append(ret, c)
 			data = data[header.PacketLength:]
@@ -309,6 +443,7 @@ func (t *TransportAssembler) ParseMSDUs(vcdu *packets.VCDU) error {
 	// If we have less than a header's worth of bytes left, save it
 	if len(data) > 0 && !vcdu.IsCorrupt {
 		t.lastSDU = append(t.lastSDU, data...)
+		t.lastSDUQuality.Add(vcdu.Quality)
 	}
 
 	t.lastVCDU = vcdu
@@ -327,46 +462,32 @@ func (t *TransportAssembler) ParseMSDUs(vcdu *packets.VCDU) error {
 
 func (t *TransportAssembler) ProcessVCDU(vcdu *packets.VCDU) error {
 	if !vcdu.IsCorrupt {
+		if t.isDuplicate(vcdu) {
+			return nil
+		}
+
+		if vcdu.VCDUReplay {
+			switch t.ReplayPolicy {
+			case ReplayIgnore:
+				t.countReplay()
+				return nil
+			case ReplaySeparate:
+				t.countReplay()
+				err := t.replayAssembler().ProcessVCDU(vcdu.AsRealtime())
+				t.updateStatus()
+				return err
+			}
+		}
+
 		if err := t.ParseMSDUs(vcdu); err != nil {
 			return err
 		}
 		t.ProcessAllAPIDs()
+		t.updateStatus()
 	}
 	return nil
 }
 
 func (t *TransportAssembler) ParseFrame(data []byte) (*packets.VCDU, error) {
-	if !packets.FrameIsValid(data) {
-		return nil, fmt.Errorf("Bad frame size! Have: %d want: %d", len(data), 892)
-	}
-
-	version := (data[0] & 0xc0) >> 6
-	scid := ((data[0] & 0x3f) << 2) | ((data[1] & 0xc0) >> 6)
-	vcid := (data[1] & 0x3f)
-	counter := (uint32(data[2]) << 16) | (uint32(data[3]) << 8) | uint32(data[4])
-	replay := ((data[5] & 0b10000000) >> 7) > 0
-	data = data[6:]
-
-	if len(data) != 886 {
-		log.Errorf("Header too large? VCDU Data zone size = %d; want 886", len(data))
-	}
-
-	fhp := ((uint16(data[0]) & 0x7) << 8) | uint16(data[1])
-	data = data[2:]
-
-	if len(data) != 884 {
-		log.Errorf("MPDU Packet zone too large/small! Got: %d want 884", len(data))
-	}
-
-	v := packets.VCDU{
-		VCDUVersion:       version,
-		VCDUSCID:          scid,
-		VCID:              vcid,
-		VCDUCounter:       counter,
-		VCDUReplay:        replay,
-		FirstHeaderOffset: fhp,
-		IsCorrupt:         false,
-		Data:              data,
-	}
-	return &v, nil
+	return t.Parser.ParseFrame(data)
 }
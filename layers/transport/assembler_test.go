@@ -0,0 +1,115 @@
+package transport
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jrwynneiii/ccsds_tools/packets"
+)
+
+// A self contained space packet, with its CRC on the end
+func spacePacket(apid uint16, counter uint16, data []byte) []byte {
+	crc := packets.CalcCRCBuffer(data)
+	length := len(data) + 2 - 1
+	b := []byte{byte(apid >> 8), byte(apid), 0xc0 | byte(counter>>8), byte(counter), byte(length >> 8), byte(length)}
+	return append(append(b, data...), byte(crc>>8), byte(crc))
+}
+
+func TestPacketOutputDoesNotBlock(t *testing.T) {
+	output := make(chan packets.MSDU, 1)
+	a := NewTransportAssembler(nil, 5)
+	a.AssembleFiles = false
+	a.PacketOutput = &output
+
+	data := append(spacePacket(100, 1, []byte{1, 2, 3, 4}), spacePacket(100, 2, []byte{5, 6, 7, 8})...)
+	a.ProcessVCDU(&packets.VCDU{VCID: 5, VCDUCounter: 1, Data: data})
+
+	if len(output) != 1 {
+		t.Fatalf("got %d packets, want 1", len(output))
+	}
+	if sdu := <-output; !sdu.CRCGood || sdu.Header.PacketSequenceCounter != 1 {
+		t.Errorf("got packet %d with CRCGood %t, want packet 1 with a good CRC", sdu.Header.PacketSequenceCounter, sdu.CRCGood)
+	}
+	if s := a.Status(); s.DroppedPackets != 1 {
+		t.Errorf("got %d dropped packets, want 1", s.DroppedPackets)
+	}
+}
+
+func TestPacketCRCOption(t *testing.T) {
+	withCRC := spacePacket(100, 1, []byte{1, 2, 3, 4})
+	// A plain space packet, with no CRC on the end
+	noCRC := []byte{0x00, 100, 0xc0, 1, 0, 3, 1, 2, 3, 4}
+
+	tests := []struct {
+		name   string
+		format string
+		opts   FrameOptions
+		packet []byte
+		want   []byte
+	}{
+		{"AOS with packet CRC", "aos", FrameOptions{PacketCRC: true}, withCRC, []byte{1, 2, 3, 4}},
+		{"AOS without packet CRC", "aos", FrameOptions{}, noCRC, []byte{1, 2, 3, 4}},
+		{"TM without packet CRC", "tm", FrameOptions{}, noCRC, []byte{1, 2, 3, 4}},
+		{"TM with packet CRC", "tm", FrameOptions{PacketCRC: true}, withCRC, []byte{1, 2, 3, 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser, err := NewFrameParser(tt.format, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			output := make(chan packets.MSDU, 1)
+			a := NewTransportAssembler(nil, 5)
+			a.Parser = parser
+			a.AssembleFiles = false
+			a.PacketOutput = &output
+
+			a.ProcessVCDU(&packets.VCDU{VCID: 5, VCDUCounter: 1, Data: tt.packet})
+			if len(output) != 1 {
+				t.Fatalf("got %d packets, want 1", len(output))
+			}
+			sdu := <-output
+			if !sdu.CRCGood || !bytes.Equal(sdu.Data, tt.want) {
+				t.Errorf("got % x with CRCGood %t, want % x with a good CRC", sdu.Data, sdu.CRCGood, tt.want)
+			}
+		})
+	}
+}
+
+func TestStaleCounter(t *testing.T) {
+	output := make(chan packets.MSDU, 1)
+	a := NewTransportAssembler(nil, 5)
+	a.AssembleFiles = false
+	a.PacketOutput = &output
+
+	packet := spacePacket(100, 1, []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12})
+	fill := []byte{0x07, 0xff, 0xc0, 0, 0, 0, 0}
+	rest := append(append([]byte{}, packet[10:]...), fill...)
+
+	// A packet split across frames 100 and 101, with an old frame 10 arriving between them
+	a.ProcessVCDU(&packets.VCDU{VCID: 5, VCDUCounter: 100, Data: packet[:10]})
+	a.ProcessVCDU(&packets.VCDU{VCID: 5, VCDUCounter: 10, FirstHeaderOffset: 2047, Data: []byte{0xde, 0xad, 0xbe, 0xef}})
+	a.ProcessVCDU(&packets.VCDU{VCID: 5, VCDUCounter: 101, FirstHeaderOffset: uint16(len(packet) - 10), Data: rest})
+
+	if s := a.Status(); s.MissedFrames != 0 || s.StaleFrames != 1 {
+		t.Errorf("got %d missed and %d stale frames, want 0 and 1", s.MissedFrames, s.StaleFrames)
+	}
+	if len(output) != 1 {
+		t.Fatalf("got %d packets, want the one split around the stale frame", len(output))
+	}
+	if sdu := <-output; !sdu.CRCGood {
+		t.Error("packet split around the stale frame failed its CRC")
+	}
+
+	// A run of frames counting on from an earlier counter means the counter really did go back
+	for i := uint32(0); i < staleResyncFrames; i++ {
+		a.ProcessVCDU(&packets.VCDU{VCID: 5, VCDUCounter: 20 + i, FirstHeaderOffset: 2047})
+	}
+	if s := a.Status(); s.StaleFrames != staleResyncFrames || s.MissedFrames != 0 {
+		t.Errorf("got %d stale and %d missed frames, want %d and 0", s.StaleFrames, s.MissedFrames, staleResyncFrames)
+	}
+	if a.lastVCDU.VCDUCounter != 20+staleResyncFrames-1 {
+		t.Errorf("last frame is %d, want %d", a.lastVCDU.VCDUCounter, 20+staleResyncFrames-1)
+	}
+}
@@ -0,0 +1,91 @@
+package transport
+
+import (
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/jrwynneiii/ccsds_tools/packets"
+)
+
+// Hands a VCDU to its assembler. In concurrent mode each VCID gets its own goroutine and input queue, so that a busy
+// image channel can't hold up the others; frames on the same VCID are still processed in order. If the queue is full
+// we wait for it to drain, unless DropOnOverflow is set
+func (t *TransportLayer) dispatch(a *TransportAssembler, vcdu *packets.VCDU) {
+	if !t.Concurrent {
+		a.ProcessVCDU(vcdu)
+		return
+	}
+
+	t.queueMutex.Lock()
+	defer t.queueMutex.Unlock()
+	if t.queuesClosed {
+		return
+	}
+
+	queue, ok := t.queues[a.VCID]
+	if !ok {
+		queue = make(chan *packets.VCDU, t.QueueSize)
+		t.queues[a.VCID] = queue
+		go a.run(queue)
+	}
+	if !t.DropOnOverflow {
+		// Destroy() closes quit before taking the queue mutex, so this can't hold it up
+		select {
+		case queue <- vcdu:
+		case <-t.quit:
+		}
+		return
+	}
+
+	select {
+	case queue <- vcdu:
+	default:
+		a.statsMutex.Lock()
+		a.QueueOverflows++
+		first := a.QueueOverflows == 1
+		a.statsMutex.Unlock()
+		if first {
+			log.Warnf("Queue for VCID %d is full, dropping frames. Consider raising transport.queue_size", a.VCID)
+		}
+		log.Debugf("Queue for VCID %d is full, dropping frame %d", a.VCID, vcdu.VCDUCounter)
+	}
+}
+
+func (t *TransportLayer) hasQueue(vcid uint8) bool {
+	t.queueMutex.Lock()
+	defer t.queueMutex.Unlock()
+	_, ok := t.queues[vcid]
+	return ok
+}
+
+// Processes VCDUs for a single VCID until the queue is closed. Eviction is done here too, since the assembler's
+// files belong to this goroutine
+func (a *TransportAssembler) run(queue chan *packets.VCDU) {
+	evictionTicker := time.NewTicker(time.Second)
+	defer evictionTicker.Stop()
+	for {
+		select {
+		case vcdu, ok := <-queue:
+			if !ok {
+				return
+			}
+			a.ProcessVCDU(vcdu)
+		case now := <-evictionTicker.C:
+			a.EvictStale(now)
+			if a.replay != nil {
+				a.replay.EvictStale(now)
+			}
+		}
+	}
+}
+
+// Stops all of the per-VCID goroutines. Nothing more is dispatched after this
+func (t *TransportLayer) stopQueues() {
+	t.queueMutex.Lock()
+	defer t.queueMutex.Unlock()
+	t.queuesClosed = true
+	for vcid, queue := range t.queues {
+		close(queue)
+		delete(t.queues, vcid)
+	}
+}
@@ -0,0 +1,94 @@
+package transport
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/jrwynneiii/ccsds_tools/packets"
+)
+
+// What to do with VCDUs that have the replay flag set
+type ReplayPolicy int
+
+const (
+	// Treat replayed frames like any other frame
+	ReplayProcess ReplayPolicy = iota
+	// Drop replayed frames
+	ReplayIgnore
+	// Reassemble replayed frames with their own assembler, so that they can't interfere with the realtime stream
+	ReplaySeparate
+)
+
+func ParseReplayPolicy(s string) (ReplayPolicy, error) {
+	switch strings.ToLower(s) {
+	case "process":
+		return ReplayProcess, nil
+	case "ignore":
+		return ReplayIgnore, nil
+	case "separate":
+		return ReplaySeparate, nil
+	}
+	return ReplayProcess, fmt.Errorf("Unknown replay policy: %s", s)
+}
+
+// How many recent frames we remember per VCID when looking for duplicates
+const duplicateWindow = 64
+
+// Returns true if we've already seen this exact frame. Frames that reuse a recent counter but have different
+// contents are let through, since that's either a counter wrap or a frame that's been corrupted, rather than a
+// retransmission
+func (t *TransportAssembler) isDuplicate(vcdu *packets.VCDU) bool {
+	h := fnv.New64a()
+	h.Write(vcdu.Data)
+	sum := h.Sum64()
+
+	if prev, ok := t.recentFrames[vcdu.VCDUCounter]; ok {
+		if prev == sum {
+			t.statsMutex.Lock()
+			t.DuplicateFrames++
+			t.statsMutex.Unlock()
+			log.Debugf("Dropping duplicate VCDU (VCID: %d, Counter: %d)", vcdu.VCID, vcdu.VCDUCounter)
+			return true
+		}
+		log.Warnf("VCDU counter %d reused on VCID %d with different contents", vcdu.VCDUCounter, vcdu.VCID)
+	} else {
+		t.recentCounters = append(t.recentCounters, vcdu.VCDUCounter)
+		if len(t.recentCounters) > duplicateWindow {
+			delete(t.recentFrames, t.recentCounters[0])
+			t.recentCounters = t.recentCounters[1:]
+		}
+	}
+	t.recentFrames[vcdu.VCDUCounter] = sum
+	return false
+}
+
+func (t *TransportAssembler) countReplay() {
+	t.statsMutex.Lock()
+	t.ReplayFrames++
+	t.statsMutex.Unlock()
+}
+
+func (t *TransportAssembler) replayAssembler() *TransportAssembler {
+	if t.replay == nil {
+		t.replay = NewTransportAssembler(t.TransportOutput, t.VCID)
+		t.replay.PacketOutput = t.PacketOutput
+		t.replay.AssembleFiles = t.AssembleFiles
+		t.replay.Handlers = t.Handlers
+		t.replay.TimeCodes = t.TimeCodes
+		t.replay.Policy = t.Policy
+		t.replay.Eviction = t.Eviction
+		t.replay.Parser = t.Parser
+	}
+	return t.replay
+}
+
+func (t *TransportLayer) SetReplayPolicy(policy ReplayPolicy) error {
+	return t.configure(func() {
+		t.ReplayPolicy = policy
+		for _, a := range t.Assemblers {
+			a.ReplayPolicy = policy
+		}
+	})
+}
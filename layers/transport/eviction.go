@@ -0,0 +1,98 @@
+package transport
+
+import (
+	"sort"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// Limits on how long, and how much, partially assembled files are kept around waiting for their last SDU
+type EvictionPolicy struct {
+	// Files that haven't had an SDU appended in this long are evicted. 0 disables
+	MaxAge time.Duration
+	// If the partial files on a VCID take up more than this many bytes, the oldest are evicted. 0 disables
+	MaxBytes int
+	// Send evicted files on, flagged as incomplete, instead of dropping them
+	EmitIncomplete bool
+}
+
+func (t *TransportAssembler) pendingBytes() int {
+	total := 0
+	for _, f := range t.Files {
+		total += len(f.RawData)
+	}
+	return total
+}
+
+// Evicts files according to the eviction policy
+func (t *TransportAssembler) EvictStale(now time.Time) {
+	defer t.updateStatus()
+
+	if t.Eviction.MaxAge > 0 {
+		for apid, f := range t.Files {
+			if now.Sub(f.LastUpdated) > t.Eviction.MaxAge {
+				log.Warnf("Evicting %s (APID %d); no SDUs received in %s", f.GetName(), apid, now.Sub(f.LastUpdated).Round(time.Second))
+				t.evict(apid)
+			}
+		}
+	}
+
+	if t.Eviction.MaxBytes > 0 && t.pendingBytes() > t.Eviction.MaxBytes {
+		var apids []uint16
+		for apid := range t.Files {
+			apids = append(apids, apid)
+		}
+		sort.Slice(apids, func(a, b int) bool {
+			return t.Files[apids[a]].LastUpdated.Before(t.Files[apids[b]].LastUpdated)
+		})
+		for _, apid := range apids {
+			if t.pendingBytes() <= t.Eviction.MaxBytes {
+				break
+			}
+			log.Warnf("Evicting %s (APID %d); VCID %d is holding more than %d bytes of partial files", t.Files[apid].GetName(), apid, t.VCID, t.Eviction.MaxBytes)
+			t.evict(apid)
+		}
+	}
+}
+
+// Removes a partially assembled file, sending it on as incomplete if the policy says so
+func (t *TransportAssembler) evict(apid uint16) {
+	f := t.Files[apid]
+	t.Drop(apid)
+	if f == nil || !t.Eviction.EmitIncomplete {
+		return
+	}
+	if err := f.CloseIncomplete(); err != nil {
+		log.Errorf("Could not emit incomplete file for APID %d: %s", apid, err.Error())
+		return
+	}
+	log.Infof("Emitting incomplete file %s (%.1f%% complete)", f.GetName(), f.Completeness)
+	*t.TransportOutput <- *f
+}
+
+func (t *TransportLayer) SetEvictionPolicy(policy EvictionPolicy) error {
+	return t.configure(func() {
+		t.Eviction = policy
+		for _, a := range t.Assemblers {
+			a.Eviction = policy
+			if a.replay != nil {
+				a.replay.Eviction = policy
+			}
+		}
+	})
+}
+
+func (t *TransportLayer) EvictStale() {
+	now := time.Now()
+	for vcid, a := range t.Assemblers {
+		if t.hasQueue(vcid) {
+			// Concurrent assemblers evict their own files
+			continue
+		}
+		a.EvictStale(now)
+		if a.replay != nil {
+			a.replay.EvictStale(now)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package transport
+
+import (
+	"fmt"
+	"sync"
+)
+
+// AOS frame header error control: a RS(10,6) code over GF(16), with field polynomial x^4 + x + 1 and code generator
+// (x + a^6)(x + a^7)(x + a^8)(x + a^9). It covers the master channel ID, VCID and signaling field, but not the VCDU
+// counter. See CCSDS 732.0-B section 4.1.2.6
+
+var (
+	gf16Exp [30]byte
+	gf16Log [16]byte
+
+	fhecGenerator []byte
+	// Error patterns of weight <= 2, keyed by the remainder they leave when divided by the generator
+	fhecSyndromes map[uint16][10]byte
+	fhecOnce      sync.Once
+)
+
+func gf16Mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gf16Exp[int(gf16Log[a])+int(gf16Log[b])]
+}
+
+func initFHEC() {
+	x := byte(1)
+	for i := 0; i < 15; i++ {
+		gf16Exp[i] = x
+		gf16Exp[i+15] = x
+		gf16Log[x] = byte(i)
+		x <<= 1
+		if x&0x10 != 0 {
+			x ^= 0x13
+		}
+	}
+
+	// Multiply out the generator, highest degree coefficient first
+	fhecGenerator = []byte{1}
+	for j := 6; j <= 9; j++ {
+		next := make([]byte, len(fhecGenerator)+1)
+		for i, c := range fhecGenerator {
+			next[i] ^= c
+			next[i+1] ^= gf16Mul(c, gf16Exp[j])
+		}
+		fhecGenerator = next
+	}
+
+	fhecSyndromes = make(map[uint16][10]byte)
+	for i := 0; i < 10; i++ {
+		for ei := byte(1); ei < 16; ei++ {
+			var e [10]byte
+			e[i] = ei
+			fhecSyndromes[fhecRemainder(e)] = e
+			for j := i + 1; j < 10; j++ {
+				for ej := byte(1); ej < 16; ej++ {
+					e[j] = ej
+					fhecSyndromes[fhecRemainder(e)] = e
+				}
+				e[j] = 0
+			}
+		}
+	}
+}
+
+// Divides the codeword by the generator, and packs the 4 symbol remainder into a uint16
+func fhecRemainder(symbols [10]byte) uint16 {
+	r := symbols
+	for i := 0; i < 6; i++ {
+		if coef := r[i]; coef != 0 {
+			for j, g := range fhecGenerator {
+				r[i+j] ^= gf16Mul(coef, g)
+			}
+		}
+	}
+	return uint16(r[6])<<12 | uint16(r[7])<<8 | uint16(r[8])<<4 | uint16(r[9])
+}
+
+// Splits the protected header fields and the FHEC into nibbles
+func fhecSymbols(header []byte) [10]byte {
+	var s [10]byte
+	for i, b := range []byte{header[0], header[1], header[5], header[6], header[7]} {
+		s[i*2] = b >> 4
+		s[i*2+1] = b & 0xf
+	}
+	return s
+}
+
+// Returns the FHEC for an AOS primary header (the first 6 bytes of the frame)
+func FHECParity(header []byte) uint16 {
+	fhecOnce.Do(initFHEC)
+	s := fhecSymbols(append(header[:6:6], 0, 0))
+	return fhecRemainder(s)
+}
+
+// Checks the FHEC of an AOS frame, fixing up to two bad nibbles of the header in place. Returns the number of nibbles
+// corrected
+func CorrectAOSHeader(data []byte) (int, error) {
+	if len(data) < 8 {
+		return 0, fmt.Errorf("Frame too short for an AOS header with FHEC")
+	}
+	fhecOnce.Do(initFHEC)
+
+	s := fhecSymbols(data)
+	syndrome := fhecRemainder(s)
+	if syndrome == 0 {
+		return 0, nil
+	}
+
+	e, ok := fhecSyndromes[syndrome]
+	if !ok {
+		return 0, fmt.Errorf("Uncorrectable AOS frame header")
+	}
+
+	corrected := 0
+	for i := range s {
+		if e[i] != 0 {
+			s[i] ^= e[i]
+			corrected++
+		}
+	}
+	for i, idx := range []int{0, 1, 5, 6, 7} {
+		data[idx] = s[i*2]<<4 | s[i*2+1]
+	}
+	return corrected, nil
+}
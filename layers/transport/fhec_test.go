@@ -0,0 +1,78 @@
+package transport
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Frames with their FHEC filled in. The FHEC values were worked out separately, by searching for the parity that
+// makes the codeword evaluate to zero at a^6..a^9
+func fhecFrame(b0, b1, signaling byte, fhec uint16) []byte {
+	return []byte{b0, b1, 0x12, 0x34, 0x56, signaling, byte(fhec >> 8), byte(fhec), 0x07, 0xff}
+}
+
+func TestFHECParity(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame []byte
+	}{
+		{"VCID 13, replay", fhecFrame(0x70, 0x4d, 0x80, 0x107b)},
+		{"VCID 5", fhecFrame(0x40, 0x05, 0x00, 0xb692)},
+		{"idle", fhecFrame(0x4c, 0x3f, 0x00, 0xc66e)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := uint16(tt.frame[6])<<8 | uint16(tt.frame[7])
+			if got := FHECParity(tt.frame[:6]); got != want {
+				t.Errorf("got FHEC %#04x, want %#04x", got, want)
+			}
+			if n, err := CorrectAOSHeader(tt.frame); n != 0 || err != nil {
+				t.Errorf("good header: got %d corrections and %v", n, err)
+			}
+		})
+	}
+}
+
+func TestCorrectAOSHeader(t *testing.T) {
+	good := fhecFrame(0x70, 0x4d, 0x80, 0x107b)
+	// Byte and shift of each nibble covered by the FHEC
+	type nibble struct {
+		idx   int
+		shift uint
+	}
+	var nibbles []nibble
+	for _, idx := range []int{0, 1, 5, 6, 7} {
+		nibbles = append(nibbles, nibble{idx, 4}, nibble{idx, 0})
+	}
+
+	corrupt := func(bad []nibble, flip byte) []byte {
+		frame := append([]byte{}, good...)
+		for _, n := range bad {
+			frame[n.idx] ^= flip << n.shift
+		}
+		return frame
+	}
+
+	for i, a := range nibbles {
+		for flip := byte(1); flip < 16; flip++ {
+			frame := corrupt([]nibble{a}, flip)
+			if n, err := CorrectAOSHeader(frame); err != nil || n != 1 || !bytes.Equal(frame, good) {
+				t.Fatalf("nibble %d flipped by %x: got %d corrections, %v, header % x", i, flip, n, err, frame[:8])
+			}
+		}
+		for j, b := range nibbles[i+1:] {
+			frame := corrupt([]nibble{a, b}, 0x9)
+			if n, err := CorrectAOSHeader(frame); err != nil || n != 2 || !bytes.Equal(frame, good) {
+				t.Fatalf("nibbles %d and %d flipped: got %d corrections, %v, header % x", i, i+1+j, n, err, frame[:8])
+			}
+		}
+	}
+
+	// Three bad nibbles are beyond the code, and must come back as an error. The code's distance is 5, so this can't
+	// hold for every pattern: about 1 in 11 three nibble errors lands within two nibbles of another valid header
+	frame := corrupt([]nibble{{1, 4}, {1, 0}, {5, 4}}, 0x5)
+	if n, err := CorrectAOSHeader(frame); err == nil {
+		t.Errorf("three bad nibbles were \"corrected\" (%d) to header % x", n, frame[:8])
+	}
+}
@@ -0,0 +1,216 @@
+package transport
+
+import (
+	"fmt"
+
+	"github.com/jrwynneiii/ccsds_tools/packets"
+)
+
+// A FrameParser turns a transfer frame, after RS decoding, into a VCDU carrying a packet zone that the assemblers can
+// pull MSDUs out of
+type FrameParser interface {
+	ParseFrame(data []byte) (*packets.VCDU, error)
+	// The virtual channel frame counter wraps at this value
+	CounterModulus() uint32
+	// Whether space packets end with a CRC-16 over their data field. xRIT adds one to every CP_PDU; plain CCSDS
+	// space packets don't have one
+	HasPacketCRC() bool
+}
+
+// CCSDS AOS (732.0-B) frames, with an M_PDU header, as used by GOES and GK-2A
+type AOSFrameParser struct {
+	FrameSize int
+	// Verify and correct the primary header with its frame header error control field
+	FHEC bool
+	// Length of the insert zone between the primary header and the M_PDU header, in bytes
+	InsertZoneLength int
+	PacketCRC        bool
+}
+
+func NewAOSFrameParser() *AOSFrameParser {
+	return &AOSFrameParser{
+		FrameSize: 892,
+		PacketCRC: true,
+	}
+}
+
+func (p *AOSFrameParser) CounterModulus() uint32 {
+	return 1 << 24
+}
+
+func (p *AOSFrameParser) HasPacketCRC() bool {
+	return p.PacketCRC
+}
+
+func (p *AOSFrameParser) ParseFrame(data []byte) (*packets.VCDU, error) {
+	if len(data) != p.FrameSize {
+		return nil, fmt.Errorf("Bad frame size! Have: %d want: %d", len(data), p.FrameSize)
+	}
+
+	corrected := 0
+	if p.FHEC {
+		var err error
+		if corrected, err = CorrectAOSHeader(data); err != nil {
+			return nil, err
+		}
+	}
+
+	version := (data[0] & 0xc0) >> 6
+	scid := ((uint16(data[0]) & 0x3f) << 2) | ((uint16(data[1]) & 0xc0) >> 6)
+	vcid := (data[1] & 0x3f)
+	counter := (uint32(data[2]) << 16) | (uint32(data[3]) << 8) | uint32(data[4])
+	replay := ((data[5] & 0b10000000) >> 7) > 0
+	data = data[6:]
+
+	if p.FHEC {
+		data = data[2:]
+	}
+	if p.InsertZoneLength > 0 {
+		if p.InsertZoneLength >= len(data)-2 {
+			return nil, fmt.Errorf("Insert zone length %d leaves no room for a packet zone", p.InsertZoneLength)
+		}
+		data = data[p.InsertZoneLength:]
+	}
+
+	fhp := ((uint16(data[0]) & 0x7) << 8) | uint16(data[1])
+	data = data[2:]
+
+	v := packets.VCDU{
+		VCDUVersion:       version,
+		VCDUSCID:          scid,
+		VCID:              vcid,
+		VCDUCounter:       counter,
+		VCDUReplay:        replay,
+		FirstHeaderOffset: fhp,
+		IsCorrupt:         false,
+		Data:              data,
+		HeaderCorrections: corrected,
+	}
+	return &v, nil
+}
+
+// CCSDS TM (132.0-B) transfer frames carrying space packets
+type TMFrameParser struct {
+	FrameSize int
+	// Whether frames end with a frame error control field (CRC-16). This is fixed per mission, not signalled in the
+	// frame
+	FECF      bool
+	PacketCRC bool
+}
+
+func NewTMFrameParser(frameSize int, fecf bool) *TMFrameParser {
+	return &TMFrameParser{
+		FrameSize: frameSize,
+		FECF:      fecf,
+	}
+}
+
+func (p *TMFrameParser) CounterModulus() uint32 {
+	return 256
+}
+
+func (p *TMFrameParser) HasPacketCRC() bool {
+	return p.PacketCRC
+}
+
+func (p *TMFrameParser) ParseFrame(data []byte) (*packets.VCDU, error) {
+	if len(data) != p.FrameSize {
+		return nil, fmt.Errorf("Bad frame size! Have: %d want: %d", len(data), p.FrameSize)
+	}
+
+	if p.FECF {
+		fecf := (uint16(data[len(data)-2]) << 8) | uint16(data[len(data)-1])
+		if crc := packets.CalcCRCBuffer(data[:len(data)-2]); crc != fecf {
+			return nil, fmt.Errorf("TM frame failed FECF check! Have: %#04x want: %#04x", crc, fecf)
+		}
+		data = data[:len(data)-2]
+	}
+
+	version := (data[0] & 0xc0) >> 6
+	scid := ((uint16(data[0]) & 0x3f) << 4) | ((uint16(data[1]) & 0xf0) >> 4)
+	vcid := (data[1] & 0x0e) >> 1
+	hasOCF := (data[1] & 0x1) > 0
+	mcCounter := data[2]
+	vcCounter := data[3]
+	hasSecondaryHeader := (data[4] & 0x80) > 0
+	syncFlag := (data[4] & 0x40) > 0
+	fhp := ((uint16(data[4]) & 0x7) << 8) | uint16(data[5])
+
+	if version != 0 {
+		return nil, fmt.Errorf("Unsupported TM transfer frame version %d", version)
+	}
+	if syncFlag {
+		return nil, fmt.Errorf("TM frames on VCID %d carry VCA_SDUs, not packets. These are not supported", vcid)
+	}
+
+	v := packets.VCDU{
+		VCDUVersion:          version,
+		VCDUSCID:             scid,
+		VCID:                 vcid,
+		VCDUCounter:          uint32(vcCounter),
+		MasterChannelCounter: mcCounter,
+		FirstHeaderOffset:    fhp,
+		IsCorrupt:            false,
+	}
+
+	if hasOCF {
+		if len(data) < 10 {
+			return nil, fmt.Errorf("TM frame too short for an OCF")
+		}
+		v.OCF = data[len(data)-4:]
+		data = data[:len(data)-4]
+	}
+	data = data[6:]
+
+	if hasSecondaryHeader {
+		// The length field is the size of the whole secondary header, including the ID field, minus one
+		length := int(data[0]&0x3f) + 1
+		if length > len(data) {
+			return nil, fmt.Errorf("TM secondary header length %d overruns the frame", length)
+		}
+		v.SecondaryHeader = data[:length]
+		data = data[length:]
+	}
+
+	// Frames with only idle data in them have a FHP of 0x7fe
+	if fhp == 0x7fe {
+		v.Idle = true
+	}
+
+	v.Data = data
+	return &v, nil
+}
+
+// Frame layout options. Only the ones that apply to the chosen format are used. FrameSize is the size of the frames
+// coming out of the data link layer, after the sync word and RS parity have been removed
+type FrameOptions struct {
+	FrameSize        int
+	FECF             bool
+	FHEC             bool
+	InsertZoneLength int
+	// Check and strip the CRC on the end of each space packet
+	PacketCRC bool
+}
+
+// Returns the parser for the named frame format
+func NewFrameParser(format string, opts FrameOptions) (FrameParser, error) {
+	switch format {
+	case "", "aos":
+		p := NewAOSFrameParser()
+		if opts.FrameSize > 0 {
+			p.FrameSize = opts.FrameSize
+		}
+		p.FHEC = opts.FHEC
+		p.InsertZoneLength = opts.InsertZoneLength
+		p.PacketCRC = opts.PacketCRC
+		return p, nil
+	case "tm":
+		if opts.FrameSize <= 0 {
+			opts.FrameSize = 892
+		}
+		p := NewTMFrameParser(opts.FrameSize, opts.FECF)
+		p.PacketCRC = opts.PacketCRC
+		return p, nil
+	}
+	return nil, fmt.Errorf("Unknown frame format: %s", format)
+}
@@ -0,0 +1,37 @@
+package transport
+
+import (
+	"github.com/jrwynneiii/ccsds_tools/packets"
+)
+
+// A PacketHandler is called with every space packet for the VCID/APID it was registered on, after its CRC has been
+// checked (see MSDU.CRCGood). APIDs without a handler fall back to LRIT file reassembly
+type PacketHandler func(sdu *packets.MSDU)
+
+// Registers a handler for the given VCID and APID. Handlers must be registered before Start() is called
+func (t *TransportLayer) Handle(vcid int, apid int, handler PacketHandler) error {
+	return t.configure(func() {
+		if t.Handlers[uint8(vcid)] == nil {
+			t.Handlers[uint8(vcid)] = make(map[uint16]PacketHandler)
+		}
+		t.Handlers[uint8(vcid)][uint16(apid)] = handler
+
+		if a := t.Assemblers[uint8(vcid)]; a != nil {
+			a.Handle(apid, handler)
+		}
+	})
+}
+
+// Removes a handler, so that the APID goes back to being reassembled into LRIT files. Must be called before Start()
+func (t *TransportLayer) Unhandle(vcid int, apid int) error {
+	return t.configure(func() {
+		delete(t.Handlers[uint8(vcid)], uint16(apid))
+		if a := t.Assemblers[uint8(vcid)]; a != nil {
+			delete(a.Handlers, uint16(apid))
+		}
+	})
+}
+
+func (t *TransportAssembler) Handle(apid int, handler PacketHandler) {
+	t.Handlers[uint16(apid)] = handler
+}
@@ -0,0 +1,123 @@
+package transport
+
+import (
+	"sort"
+	"time"
+
+	"github.com/jrwynneiii/ccsds_tools/lrit"
+)
+
+// A snapshot of a partially assembled file
+type FileProgress struct {
+	VCID          uint8
+	APID          uint16
+	Name          string
+	Segment       uint16
+	MaxSegment    uint16
+	ExpectedBytes uint64
+	BytesReceived uint64
+	Progress      float64
+	SDUsReceived  int
+	FilledRows    int
+	RecoveredRows int
+	CorruptSDUs   int
+	StartedAt     time.Time
+	LastUpdated   time.Time
+	Replay        bool
+}
+
+// A snapshot of what an assembler is working on
+type AssemblerStatus struct {
+	VCID            uint8
+	Files           []FileProgress
+	MissedFrames    int
+	DuplicateFrames int
+	ReplayFrames    int
+	DroppedPackets  int
+	QueueOverflows  int
+	StaleFrames     int
+}
+
+func newFileProgress(vcid uint8, apid uint16, f *lrit.File, replay bool) FileProgress {
+	p := FileProgress{
+		VCID:          vcid,
+		APID:          apid,
+		Name:          f.GetName(),
+		ExpectedBytes: f.PrimaryHeader.DataLength / 8,
+		BytesReceived: f.BytesReceived(),
+		Progress:      f.Progress(),
+		SDUsReceived:  f.SDUsReceived,
+		FilledRows:    f.FilledRows,
+		RecoveredRows: f.RecoveredRows,
+		CorruptSDUs:   f.CorruptSDUs,
+		StartedAt:     f.StartedAt,
+		LastUpdated:   f.LastUpdated,
+		Replay:        replay,
+	}
+	if sh := f.FindSecondaryHeader(lrit.SegmentIdentificationHeaderType); sh != nil {
+		p.Segment = sh.(lrit.SegmentIdentificationHeader).SequenceNumber
+		p.MaxSegment = sh.(lrit.SegmentIdentificationHeader).MaxSegment
+	}
+	return p
+}
+
+// Called from the assembler's own goroutine, after anything that may have changed its files, so that Status() never
+// has to touch the files themselves
+func (t *TransportAssembler) updateStatus() {
+	var files []FileProgress
+	for apid, f := range t.Files {
+		files = append(files, newFileProgress(t.VCID, apid, f, false))
+	}
+	if t.replay != nil {
+		for apid, f := range t.replay.Files {
+			files = append(files, newFileProgress(t.VCID, apid, f, true))
+		}
+	}
+	sort.Slice(files, func(a, b int) bool {
+		return files[a].StartedAt.Before(files[b].StartedAt)
+	})
+
+	t.statsMutex.Lock()
+	t.files = files
+	t.statsMutex.Unlock()
+}
+
+func (t *TransportAssembler) Status() AssemblerStatus {
+	t.statsMutex.RLock()
+	defer t.statsMutex.RUnlock()
+	return AssemblerStatus{
+		VCID:            t.VCID,
+		Files:           append([]FileProgress{}, t.files...),
+		MissedFrames:    t.MissedFrames,
+		DuplicateFrames: t.DuplicateFrames,
+		ReplayFrames:    t.ReplayFrames,
+		DroppedPackets:  t.DroppedPackets,
+		QueueOverflows:  t.QueueOverflows,
+		StaleFrames:     t.StaleFrames,
+	}
+}
+
+// Returns the state of every VCID's assembler, ordered by VCID. Safe to call from any goroutine
+func (t *TransportLayer) Status() []AssemblerStatus {
+	t.StatsMutex.RLock()
+	assemblers := append([]*TransportAssembler{}, t.assemblerList...)
+	t.StatsMutex.RUnlock()
+
+	var ret []AssemblerStatus
+	for _, a := range assemblers {
+		ret = append(ret, a.Status())
+	}
+	sort.Slice(ret, func(a, b int) bool {
+		return ret[a].VCID < ret[b].VCID
+	})
+	return ret
+}
+
+// Returns every file currently being assembled, across all VCIDs
+func (t *TransportLayer) FilesInProgress() []FileProgress {
+	var ret []FileProgress
+	for _, s := range t.Status() {
+		ret = append(ret, s.Files...)
+	}
+	return ret
+}
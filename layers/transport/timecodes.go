@@ -0,0 +1,33 @@
+package transport
+
+import (
+	"github.com/charmbracelet/log"
+	"github.com/jrwynneiii/ccsds_tools/packets"
+)
+
+// Marks an APID as carrying a time code in its packets' secondary header, so that MSDU.Time gets filled in. Must be
+// called before Start()
+func (t *TransportLayer) SetTimeCode(vcid int, apid int, format packets.TimeCodeFormat) error {
+	return t.configure(func() {
+		if t.TimeCodes[uint8(vcid)] == nil {
+			t.TimeCodes[uint8(vcid)] = make(map[uint16]packets.TimeCodeFormat)
+		}
+		t.TimeCodes[uint8(vcid)][uint16(apid)] = format
+
+		if a := t.Assemblers[uint8(vcid)]; a != nil {
+			a.TimeCodes[uint16(apid)] = format
+		}
+	})
+}
+
+func (t *TransportAssembler) decodeTime(apid uint16, sdu *packets.MSDU) {
+	format, ok := t.TimeCodes[apid]
+	if !ok || !sdu.Header.SecondaryHeaderFlag {
+		return
+	}
+	if ts, err := format.Decode(sdu.Data); err == nil {
+		sdu.Time = ts
+	} else {
+		log.Errorf("Could not decode time code for APID %d on VCID %d: %s", apid, t.VCID, err.Error())
+	}
+}
@@ -1,70 +1,286 @@
 package transport
 
 import (
+	"fmt"
 	"slices"
+	"sync"
 	"time"
 
 	"github.com/charmbracelet/log"
 	"github.com/jrwynneiii/ccsds_tools/lrit"
+	"github.com/jrwynneiii/ccsds_tools/packets"
 )
 
+var TransportStartedErr error = fmt.Errorf("Transport layer has already been started")
+
 type TransportLayer struct {
-	FramesInput     *chan []byte
+	FramesInput     *chan packets.Frame
 	TransportOutput *chan lrit.File
+	PacketOutput    *chan packets.MSDU
+	AssembleFiles   bool
+	Handlers        map[uint8]map[uint16]PacketHandler
+	TimeCodes       map[uint8]map[uint16]packets.TimeCodeFormat
 
 	Assemblers      map[uint8]*TransportAssembler
+	Parser          FrameParser
 	IgnoredChannels []uint8
+	IdleVCID        uint8
 
-	ContinueOnCRCFailure   bool
+	// Default reassembly policy. Can be overridden per VCID with SetPolicy()
+	ContinueOnCRCFailure bool
+	// What to fill missing image rows with. Defaults to zeros
+	Fill lrit.FillPolicy
+	// Deprecated: set Fill to lrit.FillZero instead. If set, this still forces zero fill
 	FillMissingSDUWithNull bool
+	Policies               map[uint8]AssemblyPolicy
+	Eviction               EvictionPolicy
+	ReplayPolicy           ReplayPolicy
+
+	// Run each VCID's assembler in its own goroutine. Packet handlers will be called from those goroutines. If a
+	// VCID's queue is full, dispatch waits for it to drain. With DropOnOverflow, the frame is dropped instead and
+	// counted in AssemblerStatus.QueueOverflows
+	Concurrent     bool
+	QueueSize      int
+	DropOnOverflow bool
+	queues         map[uint8]chan *packets.VCDU
+	queueMutex     sync.Mutex
+	queuesClosed   bool
+
+	// The setters can only be used until Start() is called. After that the assemblers' settings are read without
+	// locking, from the goroutine running Start() and from the per-VCID goroutines
+	configMutex sync.Mutex
+	started     bool
+	quit        chan struct{}
+	stopOnce    sync.Once
+
+	// If set, only frames from these spacecraft are accepted. Otherwise we lock on to whichever SCID we see
+	// SCIDLockThreshold times in a row, and reject anything else as a false lock
+	ExpectedSCIDs     []uint16
+	SCIDLockThreshold int
+
+	StatsMutex    sync.RWMutex
+	FramesPerSCID map[uint16]int
+	FalseLocks    int
+	SCID          uint16
+	SCIDLocked    bool
+	Satellite     string
+	// Frames dropped because their header could not be parsed or corrected, and header nibbles fixed by the FHEC
+	BadFrameHeaders   int
+	HeaderCorrections int
+
+	scidCandidate uint16
+	scidRun       int
+	assemblerList []*TransportAssembler
 }
 
-func New(input *chan []byte, output *chan lrit.File) *TransportLayer {
+func New(input *chan packets.Frame, output *chan lrit.File) *TransportLayer {
 	return &TransportLayer{
-		FramesInput:            input,
-		TransportOutput:        output,
-		Assemblers:             make(map[uint8]*TransportAssembler),
-		ContinueOnCRCFailure:   false,
-		FillMissingSDUWithNull: true,
+		FramesInput:          input,
+		TransportOutput:      output,
+		Assemblers:           make(map[uint8]*TransportAssembler),
+		Parser:               NewAOSFrameParser(),
+		ContinueOnCRCFailure: false,
+		Fill:                 lrit.FillZero,
+		SCIDLockThreshold:    16,
+		IdleVCID:             63,
+		AssembleFiles:        true,
+		Handlers:             make(map[uint8]map[uint16]PacketHandler),
+		TimeCodes:            make(map[uint8]map[uint16]packets.TimeCodeFormat),
+		Policies:             make(map[uint8]AssemblyPolicy),
+		QueueSize:            256,
+		queues:               make(map[uint8]chan *packets.VCDU),
+		FramesPerSCID:        make(map[uint16]int),
+		quit:                 make(chan struct{}),
 	}
 }
 
-func (t *TransportLayer) IgnoreChannel(id int) {
-	if !slices.Contains(t.IgnoredChannels, uint8(id)) {
-		t.IgnoredChannels = append(t.IgnoredChannels, uint8(id))
+// Makes a change to the layer's settings, unless it's already been started
+func (t *TransportLayer) configure(change func()) error {
+	t.configMutex.Lock()
+	defer t.configMutex.Unlock()
+	if t.started {
+		return TransportStartedErr
 	}
+	change()
+	return nil
+}
+
+func (t *TransportLayer) DefaultPolicy() AssemblyPolicy {
+	p := AssemblyPolicy{
+		ContinueOnCRCFailure: t.ContinueOnCRCFailure,
+		Fill:                 t.Fill,
+	}
+	if t.FillMissingSDUWithNull {
+		p.Fill = lrit.FillZero
+	}
+	return p
+}
+
+func (t *TransportLayer) PolicyFor(vcid uint8) AssemblyPolicy {
+	if p, ok := t.Policies[vcid]; ok {
+		return p
+	}
+	return t.DefaultPolicy()
+}
+
+func (t *TransportLayer) SetPolicy(vcid int, policy AssemblyPolicy) error {
+	return t.configure(func() {
+		t.Policies[uint8(vcid)] = policy
+		if a := t.Assemblers[uint8(vcid)]; a != nil {
+			a.Policy = policy
+		}
+	})
+}
+
+func (t *TransportLayer) ExpectSCID(scid int) error {
+	return t.configure(func() {
+		if !slices.Contains(t.ExpectedSCIDs, uint16(scid)) {
+			t.ExpectedSCIDs = append(t.ExpectedSCIDs, uint16(scid))
+		}
+	})
 }
 
+// Returns false if the frame's spacecraft ID says that it's not from the spacecraft we're locked on to
+func (t *TransportLayer) checkSCID(scid uint16) bool {
+	t.StatsMutex.Lock()
+	defer t.StatsMutex.Unlock()
+
+	t.FramesPerSCID[scid]++
+
+	if len(t.ExpectedSCIDs) > 0 {
+		if !slices.Contains(t.ExpectedSCIDs, scid) {
+			t.FalseLocks++
+			return false
+		}
+		t.setSCID(scid)
+		return true
+	}
+
+	if scid == t.scidCandidate {
+		t.scidRun++
+	} else {
+		t.scidCandidate = scid
+		t.scidRun = 1
+	}
+
+	if t.SCIDLocked && scid != t.SCID {
+		// A different spacecraft consistently showing up means we've repointed, not that we have a false lock
+		if t.scidRun >= t.SCIDLockThreshold {
+			log.Warnf("Spacecraft changed from SCID %d to %d", t.SCID, scid)
+			t.setSCID(scid)
+			return true
+		}
+		t.FalseLocks++
+		return false
+	}
+
+	if !t.SCIDLocked && t.scidRun >= t.SCIDLockThreshold {
+		t.setSCID(scid)
+		t.SCIDLocked = true
+	} else if t.SCIDLocked && t.Satellite == "" {
+		// The satellite may have been learned from a product name since we locked
+		t.setSCID(scid)
+	}
+	return true
+}
+
+func (t *TransportLayer) setSCID(scid uint16) {
+	t.SCID = scid
+	if name, ok := packets.SpacecraftName(scid); ok {
+		t.Satellite = name
+	} else {
+		t.Satellite = ""
+	}
+}
+
+func (t *TransportLayer) IgnoreChannel(id int) error {
+	return t.configure(func() {
+		if !slices.Contains(t.IgnoredChannels, uint8(id)) {
+			t.IgnoredChannels = append(t.IgnoredChannels, uint8(id))
+		}
+	})
+}
+
+// Processes frames until Destroy() is called
 func (t *TransportLayer) Start() {
-	t.IgnoreChannel(63)
+	t.IgnoreChannel(int(t.IdleVCID))
+	t.configMutex.Lock()
+	t.started = true
+	t.configMutex.Unlock()
+
+	evictionTicker := time.NewTicker(time.Second)
+	defer evictionTicker.Stop()
 	for {
 		select {
+		case <-t.quit:
+			return
 		case frame := <-*t.FramesInput:
 			t.ProcessFrame(frame)
+		case <-evictionTicker.C:
+			t.EvictStale()
 		default:
 			time.Sleep(time.Millisecond)
 		}
 	}
 }
 
-func (t *TransportLayer) ProcessFrame(data []byte) {
+func (t *TransportLayer) ProcessFrame(frame packets.Frame) {
+	vcdu, err := t.Parser.ParseFrame(frame.Data)
+	if err != nil {
+		t.StatsMutex.Lock()
+		t.BadFrameHeaders++
+		t.StatsMutex.Unlock()
+		log.Error(err)
+		return
+	}
+	vcdu.Quality = frame.Quality
+	if vcdu.HeaderCorrections > 0 {
+		t.StatsMutex.Lock()
+		t.HeaderCorrections += vcdu.HeaderCorrections
+		t.StatsMutex.Unlock()
+	}
+
+	// Frames from another spacecraft are a false lock, so they mustn't leave an assembler behind for their VCID
+	if !t.checkSCID(vcdu.VCDUSCID) {
+		log.Debugf("Rejecting frame from unexpected SCID %d (VCID: %d, Counter: %d)", vcdu.VCDUSCID, vcdu.VCID, vcdu.VCDUCounter)
+		return
+	}
+	if vcdu.Idle {
+		return
+	}
+
 	//Create our transport assembler if it doesn't exist
-	vcid := uint8(data[1]) & 0x3f
+	vcid := vcdu.VCID
 	if t.Assemblers[vcid] == nil {
 		t.Assemblers[vcid] = NewTransportAssembler(t.TransportOutput, vcid)
+		t.StatsMutex.Lock()
+		t.assemblerList = append(t.assemblerList, t.Assemblers[vcid])
+		t.StatsMutex.Unlock()
+		t.Assemblers[vcid].Parser = t.Parser
+		t.Assemblers[vcid].PacketOutput = t.PacketOutput
+		t.Assemblers[vcid].AssembleFiles = t.AssembleFiles
+		t.Assemblers[vcid].Policy = t.PolicyFor(vcid)
+		t.Assemblers[vcid].Eviction = t.Eviction
+		t.Assemblers[vcid].ReplayPolicy = t.ReplayPolicy
+		for apid, handler := range t.Handlers[vcid] {
+			t.Assemblers[vcid].Handle(int(apid), handler)
+		}
+		for apid, format := range t.TimeCodes[vcid] {
+			t.Assemblers[vcid].TimeCodes[apid] = format
+		}
 	}
 
-	if vcdu, err := t.Assemblers[vcid].ParseFrame(data); err == nil {
-		if !slices.Contains(t.IgnoredChannels, vcdu.VCID) {
-			t.Assemblers[vcid].ProcessVCDU(vcdu)
-		}
-	} else {
-		log.Error(err)
+	if !slices.Contains(t.IgnoredChannels, vcdu.VCID) {
+		t.dispatch(t.Assemblers[vcid], vcdu)
 	}
 }
 
-// Boilerplate to satisfy interface
+// Stops Start(), and the per-VCID goroutines. Frames that are still queued are dropped
 func (t *TransportLayer) Destroy() {
+	t.stopOnce.Do(func() {
+		close(t.quit)
+	})
+	t.stopQueues()
 }
 
 func (t *TransportLayer) GetInput() any {
@@ -75,7 +291,35 @@ func (t *TransportLayer) GetOutput() any {
 	return t.TransportOutput
 }
 
+// Space packets are only output once this has been called. Packets are sent on the returned channel alongside LRIT
+// file reassembly, unless AssembleFiles has been turned off. Must be called before Start()
+func (t *TransportLayer) EnablePacketOutput(bufsize uint) *chan packets.MSDU {
+	err := t.configure(func() {
+		output := make(chan packets.MSDU, bufsize)
+		t.PacketOutput = &output
+		for _, a := range t.Assemblers {
+			a.PacketOutput = t.PacketOutput
+		}
+	})
+	if err != nil {
+		log.Errorf("Could not enable packet output: %s", err.Error())
+	}
+	return t.PacketOutput
+}
+
+func (t *TransportLayer) GetPacketOutput() *chan packets.MSDU {
+	return t.PacketOutput
+}
+
 func (t *TransportLayer) Reset() {
+	t.StatsMutex.Lock()
+	t.FramesPerSCID = make(map[uint16]int)
+	t.FalseLocks = 0
+	t.BadFrameHeaders = 0
+	t.HeaderCorrections = 0
+	t.SCIDLocked = false
+	t.scidRun = 0
+	t.StatsMutex.Unlock()
 }
 
 func (t *TransportLayer) Flush() {
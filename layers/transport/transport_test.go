@@ -0,0 +1,203 @@
+package transport
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jrwynneiii/ccsds_tools/lrit"
+	"github.com/jrwynneiii/ccsds_tools/packets"
+)
+
+// An AOS frame carrying the given space packets, padded out with a fill packet. With no packets, the frame has no
+// packet headers in it
+func aosFrame(scid uint16, vcid uint8, counter uint32, sdus ...[]byte) packets.Frame {
+	data := make([]byte, 892)
+	data[0] = 0x40 | byte(scid>>2)
+	data[1] = byte(scid&0x3)<<6 | vcid
+	data[2], data[3], data[4] = byte(counter>>16), byte(counter>>8), byte(counter)
+	data[6], data[7] = 0x07, 0xff
+	if len(sdus) > 0 {
+		data[6], data[7] = 0, 0
+		zone := data[:8]
+		for _, sdu := range sdus {
+			zone = append(zone, sdu...)
+		}
+		fill := len(data) - len(zone) - 6 - 1
+		zone = append(zone, 0x07, 0xff, 0xc0, 0, byte(fill>>8), byte(fill))
+		data = append(zone, make([]byte, fill+1)...)
+	}
+	return packets.Frame{Data: data}
+}
+
+func TestRejectedSCIDCreatesNoAssembler(t *testing.T) {
+	output := make(chan lrit.File, 1)
+	layer := New(nil, &output)
+	layer.ExpectSCID(195)
+
+	layer.ProcessFrame(aosFrame(100, 5, 1))
+	if len(layer.Assemblers) != 0 || len(layer.Status()) != 0 {
+		t.Errorf("frame from an unexpected SCID left %d assemblers behind", len(layer.Assemblers))
+	}
+	if layer.FalseLocks != 1 {
+		t.Errorf("got %d false locks, want 1", layer.FalseLocks)
+	}
+
+	layer.ProcessFrame(aosFrame(195, 5, 2))
+	if layer.Assemblers[5] == nil {
+		t.Error("no assembler for a frame from the expected SCID")
+	}
+	if layer.Satellite != "GK-2A" {
+		t.Errorf("got satellite %q, want GK-2A", layer.Satellite)
+	}
+}
+
+func TestSettingsAreFixedOnceStarted(t *testing.T) {
+	input := make(chan packets.Frame)
+	output := make(chan lrit.File, 1)
+	layer := New(&input, &output)
+	if err := layer.SetPolicy(5, AssemblyPolicy{Fill: lrit.FillZero}); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		layer.Start()
+		close(done)
+	}()
+	layer.Destroy()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Start() didn't return after Destroy()")
+	}
+
+	handler := func(sdu *packets.MSDU) {}
+	for name, err := range map[string]error{
+		"SetPolicy":   layer.SetPolicy(5, AssemblyPolicy{}),
+		"Handle":      layer.Handle(5, 100, handler),
+		"Unhandle":    layer.Unhandle(5, 100),
+		"SetTimeCode": layer.SetTimeCode(5, 100, packets.TimeCodeFormat{}),
+	} {
+		if !errors.Is(err, TransportStartedErr) {
+			t.Errorf("%s after Start() returned %v, want TransportStartedErr", name, err)
+		}
+	}
+	if layer.EnablePacketOutput(1) != nil {
+		t.Error("packet output was enabled after Start()")
+	}
+}
+
+func TestConcurrentQueueOverflow(t *testing.T) {
+	output := make(chan lrit.File, 1)
+	layer := New(nil, &output)
+	layer.Concurrent = true
+	layer.QueueSize = 1
+	layer.DropOnOverflow = true
+
+	// Hold up the VCID's goroutine in the first packet's handler
+	release := make(chan struct{})
+	layer.Handle(5, 100, func(sdu *packets.MSDU) {
+		<-release
+	})
+	for i := 0; i < 4; i++ {
+		layer.ProcessFrame(aosFrame(195, 5, uint32(i), spacePacket(100, uint16(i), []byte{1, 2, 3, 4})))
+	}
+	if s := layer.Status(); len(s) != 1 || s[0].QueueOverflows < 2 {
+		t.Errorf("got status %+v, want at least 2 queue overflows", s)
+	}
+
+	// Nothing may be sent on the closed queues once the layer has been destroyed
+	layer.Destroy()
+	layer.ProcessFrame(aosFrame(195, 5, 4, spacePacket(100, 4, []byte{1, 2, 3, 4})))
+	close(release)
+}
+
+func TestConcurrentQueueBackpressure(t *testing.T) {
+	output := make(chan lrit.File, 1)
+	layer := New(nil, &output)
+	layer.Concurrent = true
+	layer.QueueSize = 1
+
+	release := make(chan struct{})
+	handled := make(chan uint16, 8)
+	layer.Handle(5, 100, func(sdu *packets.MSDU) {
+		<-release
+		handled <- sdu.Header.PacketSequenceCounter
+	})
+	dispatched := make(chan struct{})
+	go func() {
+		for i := 0; i < 4; i++ {
+			layer.ProcessFrame(aosFrame(195, 5, uint32(i), spacePacket(100, uint16(i), []byte{1, 2, 3, 4})))
+		}
+		close(dispatched)
+	}()
+
+	// One frame is in the handler and one is queued, so the third has to wait
+	select {
+	case <-dispatched:
+		t.Fatal("dispatch didn't wait for the full queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-dispatched
+	for i := 0; i < 4; i++ {
+		select {
+		case counter := <-handled:
+			if counter != uint16(i) {
+				t.Errorf("handled packet %d, want %d", counter, i)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("only %d of 4 packets were handled", i)
+		}
+	}
+	if s := layer.Status(); len(s) != 1 || s[0].QueueOverflows != 0 {
+		t.Errorf("got status %+v, want no queue overflows", s)
+	}
+	layer.Destroy()
+}
+
+func TestDestroyUnblocksDispatch(t *testing.T) {
+	output := make(chan lrit.File, 1)
+	layer := New(nil, &output)
+	layer.Concurrent = true
+	layer.QueueSize = 1
+
+	release := make(chan struct{})
+	defer close(release)
+	layer.Handle(5, 100, func(sdu *packets.MSDU) {
+		<-release
+	})
+	dispatched := make(chan struct{})
+	go func() {
+		for i := 0; i < 4; i++ {
+			layer.ProcessFrame(aosFrame(195, 5, uint32(i), spacePacket(100, uint16(i), []byte{1, 2, 3, 4})))
+		}
+		close(dispatched)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	layer.Destroy()
+	select {
+	case <-dispatched:
+	case <-time.After(time.Second):
+		t.Fatal("dispatch is still blocked after Destroy")
+	}
+}
+
+func TestDefaultFillPolicy(t *testing.T) {
+	layer := New(nil, nil)
+	if p := layer.DefaultPolicy(); p.Fill != lrit.FillZero {
+		t.Errorf("default fill is %s, want zero", p.Fill)
+	}
+	for _, fill := range []lrit.FillPolicy{lrit.FillLastRow, lrit.FillDrop} {
+		layer.Fill = fill
+		if p := layer.DefaultPolicy(); p.Fill != fill {
+			t.Errorf("got fill %s, want %s", p.Fill, fill)
+		}
+	}
+	layer.FillMissingSDUWithNull = true
+	if p := layer.DefaultPolicy(); p.Fill != lrit.FillZero {
+		t.Errorf("deprecated FillMissingSDUWithNull gave fill %s, want zero", p.Fill)
+	}
+}
@@ -4,13 +4,11 @@ import (
 	"archive/zip"
 	"bytes"
 	"io"
-
-	"github.com/opensatelliteproject/goaec/szwrap"
 )
 
 func (l File) ContainsZipArchive() bool {
-	nsh := l.FindSecondaryHeader(NOAASpecificHeaderType).(NOAASpecificHeader)
-	if l.PrimaryHeader.FileType != 0 && nsh.NOAASpecificCompression == 10 {
+	nsh, err := l.GetNOAASpecificHeader()
+	if err == nil && l.PrimaryHeader.FileType != 0 && nsh.NOAASpecificCompression == 10 {
 		return true
 	}
 	return false
@@ -65,17 +63,15 @@ func (l File) IsRiceCompressed() bool {
 	return false
 }
 
+// Decompresses one scanline. NOAA don't set the raw option in their headers, but their images are raw
 func RiceDecompressBuffer(data []byte, rch RiceCompressionHeader, ish ImageStructureHeader) ([]byte, error) {
-	pixels := rch.PixelsPerBlock
-	flags := rch.Flags
-	cols := ish.NumCols
-	var ret []byte
-	if decompresseddata, err := szwrap.NOAADecompress(data, int(ish.BitsPerPixel), int(pixels), int(cols), int(flags)); err == nil {
-		ret = decompresseddata
-	} else {
+	if len(data) == 0 {
+		return make([]byte, int(ish.NumCols)*riceSampleBytes(int(ish.BitsPerPixel))), nil
+	}
+	ret, _, err := riceDecompress(data, int(ish.BitsPerPixel), int(rch.PixelsPerBlock), int(ish.NumCols), 1, int(rch.Flags)|RiceRawOption)
+	if err != nil {
 		return data, err
 	}
-
 	return ret, nil
 }
 
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/log"
 	"github.com/jrwynneiii/ccsds_tools/packets"
@@ -15,6 +16,9 @@ func OpenNew(sdu *packets.MSDU) (*File, error) {
 		//If we don't have a valid CRC, drop this SDU
 		return nil, fmt.Errorf("CRC Mismatch in OpenNew()")
 	}
+	if len(sdu.Data) < 10 {
+		return nil, fmt.Errorf("SDU too short to start a file: %d bytes", len(sdu.Data))
+	}
 
 	f := &File{
 		UnzippedData: make(map[string][]byte),
@@ -22,7 +26,13 @@ func OpenNew(sdu *packets.MSDU) (*File, error) {
 		VCDUVersion:  sdu.VCDUVersion,
 		VCID:         sdu.VCID,
 		CRCGood:      true,
+		Quality:      sdu.Quality,
+		SCID:         sdu.VCDUSCID,
+		StartedAt:    time.Now(),
+		SDUsReceived: 1,
 	}
+	f.LastUpdated = f.StartedAt
+	f.Satellite, _ = packets.SpacecraftName(sdu.VCDUSCID)
 
 	var err error
 	if f.PrimaryHeader, err = MakePrimaryHeader(f.RawData); err == nil {
@@ -42,48 +52,83 @@ func OpenNew(sdu *packets.MSDU) (*File, error) {
 	return f, nil
 }
 
-func (f *File) RiceDecompressIfNeededAndAppendBuffer(data []byte) ([]byte, error) {
-	if len(data) > 0 {
-		var err error
-		needsDecompress := false
-		var ish ImageStructureHeader
-		if f.HeadersPopulated() && f.IsImageFile() {
-			if ish, err = f.GetImageStructureHeader(); err == nil {
-				if nsh, err := f.GetNOAASpecificHeader(); err == nil {
-					if ish.IsCompressed == 1 && nsh.NOAASpecificCompression == 1 {
-						needsDecompress = true
-					} else {
-						log.Infof("File is image, has all headers, but is not compressed")
-					}
-				} else {
-					log.Errorf("Could not find NSH")
-				}
-			} else {
-				log.Errorf("Could not find ISH")
-			}
-		}
+// Returns the file's Rice stream, starting it once the headers show that the file is a Rice compressed image
+func (f *File) riceStream() *RiceStream {
+	if f.Rice != nil || !f.HeadersPopulated() || !f.IsImageFile() || !f.IsRiceCompressed() {
+		return f.Rice
+	}
+	ish, err := f.GetImageStructureHeader()
+	if err != nil {
+		return nil
+	}
+	if nsh, err := f.GetNOAASpecificHeader(); err != nil || nsh.NOAASpecificCompression != 1 {
+		return nil
+	}
+	rch, err := f.GetRiceCompressionHeader()
+	if err != nil {
+		log.Warnf("%s is a Rice compressed image, but has no Rice compression header; keeping its data compressed", f.GetName())
+		return nil
+	}
+	f.Rice = NewRiceStream(ish, rch)
+	return f.Rice
+}
 
-		if needsDecompress {
-			if rch, err := f.GetRiceCompressionHeader(); err == nil {
-				if d, err := RiceDecompressBuffer(data, rch, ish); err == nil {
-					return d, nil
-				} else {
-					//If decompression fails, just insert black lines
-					return []byte{}, fmt.Errorf("Rice decompress failed: %s", err.Error())
-				}
-			} else {
-				//Has no rch
-				return []byte{}, fmt.Errorf("LRIT file is Rice compressed image, but has no Rice Compression header!")
-			}
-		} else {
-			return data, fmt.Errorf("LRIT file does not have all headers yet or is not an image")
+// Appends a packet of file data, decompressing it first if the file is a Rice compressed image. Packets that can't
+// be decompressed are replaced with fill rows, so the rest of the image stays in place
+func (f *File) appendData(data []byte) error {
+	s := f.riceStream()
+	if s == nil {
+		f.RawData = append(f.RawData, data...)
+		return nil
+	}
+
+	row := s.Row
+	d, rows, err := s.Decode(data)
+	if err != nil {
+		log.Warnf("Could not decompress packet at row %d of %s: %s", row, f.GetName(), err.Error())
+		return f.FillPackets(1)
+	}
+	f.RawData = append(f.RawData, d...)
+	f.RecoveredRows += rows
+	return nil
+}
+
+// Number of image rows in each packet
+func (f *File) RowsPerPacket() int {
+	if s := f.riceStream(); s != nil {
+		return s.LinesPerPacket()
+	}
+	return 1
+}
+
+// Fills in the rows of n image packets that were lost or couldn't be decompressed
+func (f *File) FillPackets(n int) error {
+	rows := n * f.RowsPerPacket()
+	if s := f.riceStream(); s != nil {
+		rows = s.Skip(rows)
+	}
+	return f.fillRows(rows)
+}
+
+func (f *File) fillRows(n int) error {
+	for i := 0; i < n; i++ {
+		row, err := f.FillRow()
+		if err != nil {
+			return err
 		}
+		f.RawData = append(f.RawData, row...)
+		f.FilledRows++
 	}
-	return data, fmt.Errorf("Can't decompress: not enough data")
+	return nil
 }
 
 func (f *File) Append(sdu *packets.MSDU) error {
-	if !sdu.CRCGood {
+	if !sdu.CRCGood && f.ContinueOnCRCFailure {
+		// Keep the SDU, but flag the file so that the session layer knows it's corrupt
+		log.Warnf("Found CRC mismatch in SDU for %s; keeping it and flagging the file", f.GetName())
+		f.CRCGood = false
+		f.CorruptSDUs++
+	} else if !sdu.CRCGood {
 		if f.PrimaryHeaderPopulated && f.SecondaryHeadersPopulated {
 			if !f.IsImageFile() {
 				log.Warnf("<ASSEMBLER> Detected CRC mismatch in SDU for packet.")
@@ -97,6 +142,10 @@ func (f *File) Append(sdu *packets.MSDU) error {
 		}
 	}
 
+	f.Quality.Merge(sdu.Quality)
+	f.LastUpdated = time.Now()
+	f.SDUsReceived++
+
 	var err error
 
 	//Attempt to make secondary header objs
@@ -108,52 +157,144 @@ func (f *File) Append(sdu *packets.MSDU) error {
 				remaining = f.RawData[f.PrimaryHeader.AllHeaderLength:]
 				f.RawData = f.RawData[:f.PrimaryHeader.AllHeaderLength]
 			}
-			if d, err := f.RiceDecompressIfNeededAndAppendBuffer(remaining); err == nil {
-				f.RawData = append(f.RawData, d...)
-			} else {
-				log.Error(err)
-				f.RawData = append(f.RawData, remaining...)
+			if len(remaining) > 0 {
+				if err := f.appendData(remaining); err != nil {
+					return err
+				}
 			}
 		}
 	}
 
-	//Try to decompress the sdu if we already know its an image file
-	if d, err := f.RiceDecompressIfNeededAndAppendBuffer(sdu.Data); err == nil {
-		f.RawData = append(f.RawData, d...)
-	} else {
-		log.Error(err)
-		f.RawData = append(f.RawData, sdu.Data...)
+	return f.appendData(sdu.Data)
+}
+
+// Number of data bytes (after the headers) received so far
+func (f *File) BytesReceived() uint64 {
+	if len(f.Data) > 0 {
+		return uint64(len(f.Data))
+	}
+	if f.PrimaryHeaderPopulated && uint64(len(f.RawData)) > uint64(f.PrimaryHeader.AllHeaderLength) {
+		return uint64(len(f.RawData)) - uint64(f.PrimaryHeader.AllHeaderLength)
+	}
+	return 0
+}
+
+// Percentage of the file's data received so far
+func (f *File) Progress() float64 {
+	// The data length of a compressed image is its compressed size, so go by rows instead
+	if f.Rice != nil && f.Rice.ISH.NumRows > 0 {
+		return float64(f.Rice.Row) / float64(f.Rice.ISH.NumRows) * 100
+	}
+	expected := f.PrimaryHeader.DataLength / 8
+	if expected == 0 {
+		return 0
+	}
+	return min(100, float64(f.BytesReceived())/float64(expected)*100)
+}
+
+// Closes out a file that will never be completed. Images are padded out to their full size according to the fill
+// policy, so that they can still be used
+func (f *File) CloseIncomplete() error {
+	f.Completeness = f.Progress()
+	f.Incomplete = true
+
+	if !f.HeadersPopulated() {
+		return fmt.Errorf("Invalid LRIT file! Could not create headers")
 	}
 
+	if f.IsImageFile() && f.Fill != FillDrop {
+		return f.Close()
+	}
+
+	f.Data = f.RawData[f.PrimaryHeader.AllHeaderLength:]
+	f.identifySatellite()
 	return nil
 }
 
 func (f *File) MissingRows() uint64 {
-	datalen := uint64(len(f.Data))
-	if len(f.Data) == 0 {
-		datalen = uint64(len(f.RawData[f.PrimaryHeader.AllHeaderLength:]))
+	if f.Rice != nil {
+		return uint64(f.Rice.RemainingRows())
 	}
+	datalen := f.BytesReceived()
 	if f.IsImageFile() {
-		if ish, err := f.GetImageStructureHeader(); err == nil {
+		if ish, err := f.GetImageStructureHeader(); err == nil && ish.NumCols > 0 && datalen < f.PrimaryHeader.DataLength/8 {
 			missingBytes := (f.PrimaryHeader.DataLength / 8) - datalen
-			missingRows := missingBytes / uint64(ish.NumCols)
+			missingRows := missingBytes / uint64(rowBytes(ish))
 			return missingRows
 		}
 	}
 	return 0
 }
 
+// How gaps in an image are filled in, when SDUs go missing
+type FillPolicy int
+
+const (
+	// Repeat the last row received
+	FillLastRow FillPolicy = iota
+	// Fill with black (zeroed) rows
+	FillZero
+	// Don't fill, and drop the whole file instead
+	FillDrop
+)
+
+func ParseFillPolicy(s string) (FillPolicy, error) {
+	switch strings.ToLower(s) {
+	case "last_row", "lastrow", "repeat":
+		return FillLastRow, nil
+	case "zero", "null", "black":
+		return FillZero, nil
+	case "drop", "none":
+		return FillDrop, nil
+	}
+	return FillLastRow, fmt.Errorf("Unknown fill policy: %s", s)
+}
+
+func (p FillPolicy) String() string {
+	switch p {
+	case FillLastRow:
+		return "last_row"
+	case FillZero:
+		return "zero"
+	case FillDrop:
+		return "drop"
+	}
+	return fmt.Sprintf("FillPolicy(%d)", int(p))
+}
+
+// The length of one decoded row, in bytes. Pixels wider than 8 bits take 2 or 4 bytes each, as they do when
+// decompressed
+func rowBytes(ish ImageStructureHeader) int {
+	return int(ish.NumCols) * riceSampleBytes(int(ish.BitsPerPixel))
+}
+
+// Returns a row to fill a gap with, according to the file's fill policy. Returns an error if the policy says the
+// file should be dropped instead
+func (f *File) FillRow() ([]byte, error) {
+	switch f.Fill {
+	case FillZero:
+		if ish, err := f.GetImageStructureHeader(); err == nil {
+			return make([]byte, rowBytes(ish)), nil
+		}
+		return []byte{}, nil
+	case FillDrop:
+		return nil, fmt.Errorf("Not filling missing rows in %s; fill policy is drop", f.GetName())
+	}
+	return f.GetFillRow(), nil
+}
+
 func (f *File) GetFillRow() []byte {
 	if f.IsImageFile() {
 		if ish, err := f.GetImageStructureHeader(); err == nil {
-			if len(f.Data) == 0 && uint32(len(f.RawData)) > uint32(ish.NumCols)+f.PrimaryHeader.AllHeaderLength {
-				return f.RawData[len(f.RawData)-int(ish.NumCols):]
+			row := rowBytes(ish)
+			if len(f.Data) == 0 && uint32(len(f.RawData)) > uint32(row)+f.PrimaryHeader.AllHeaderLength {
+				return f.RawData[len(f.RawData)-row:]
 			}
 
-			if len(f.Data) > int(ish.NumCols) {
-				return f.Data[len(f.Data)-int(ish.NumCols):]
+			if len(f.Data) > row {
+				return f.Data[len(f.Data)-row:]
 			} else {
-				return make([]byte, ish.NumCols)
+				return make([]byte, row)
 			}
 		}
 	}
@@ -169,27 +310,45 @@ func (f *File) Close() error {
 
 	f.Data = f.RawData[f.PrimaryHeader.AllHeaderLength:]
 
+	f.identifySatellite()
+
 	if f.IsImageFile() {
-		if ish, err := f.GetImageStructureHeader(); err == nil {
-			missingBytes := (f.PrimaryHeader.DataLength / 8) - uint64(len(f.Data))
-			missingRows := missingBytes / uint64(ish.NumCols)
-			log.Debugf("Expected len: %d, Actual len: %d, expected rows: %d, got rows: %d, expected cols: %d",
-				f.PrimaryHeader.DataLength/8, len(f.Data), ish.NumRows, len(f.Data)/int(ish.NumRows), ish.NumCols)
-			log.Debugf("Missing bytes: %d, missing rows: %d", missingBytes, missingRows)
+		if ish, err := f.GetImageStructureHeader(); err == nil && ish.NumCols > 0 && ish.NumRows > 0 {
+			missingRows := f.MissingRows()
+			log.Debugf("Expected len: %d, Actual len: %d, expected rows: %d, expected cols: %d, missing rows: %d",
+				f.PrimaryHeader.DataLength/8, len(f.Data), ish.NumRows, ish.NumCols, missingRows)
 			if missingRows < uint64(ish.NumRows) && missingRows > 0 {
-				for i := uint64(0); i < missingRows; i++ {
-					log.Debugf("Filling image with %d pixels", ish.NumCols)
-					f.RawData = append(f.RawData, f.GetFillRow()...)
-					f.Data = append(f.Data, f.GetFillRow()...)
+				log.Debugf("Filling image with %d rows of %d pixels", missingRows, ish.NumCols)
+				if f.Rice != nil {
+					f.Rice.Skip(int(missingRows))
 				}
+				if err := f.fillRows(int(missingRows)); err != nil {
+					return err
+				}
+				f.Data = f.RawData[f.PrimaryHeader.AllHeaderLength:]
 			}
 		}
+		if f.Rice != nil {
+			log.Debugf("%s: decompressed %d rows, filled %d", f.GetName(), f.RecoveredRows, f.FilledRows)
+		}
 	}
 	log.Debug("Finished filling file and closing")
 
 	return nil
 }
 
+// If we don't know which satellite this SCID belongs to yet, let the product name count towards working it out. The
+// file is only labelled once enough of them agree
+func (f *File) identifySatellite() {
+	if f.Satellite != "" {
+		return
+	}
+	if packets.LearnSpacecraft(f.SCID, f.VCID, packets.SatelliteFromProductName(f.GetName())) {
+		log.Infof("Identified SCID %d as %s", f.SCID, packets.SatelliteFromProductName(f.GetName()))
+	}
+	f.Satellite, _ = packets.SpacecraftName(f.SCID)
+}
+
 func (f File) HeadersPopulated() bool {
 	if !f.PrimaryHeaderPopulated {
 		return false
@@ -206,7 +365,8 @@ func (f File) HeadersPopulated() bool {
 
 func (l File) WriteFile(dir string) {
 	filenamefull := l.GetName()
-	productID := l.FindSecondaryHeader(NOAASpecificHeaderType).(NOAASpecificHeader).ProductID
+	nsh, _ := l.GetNOAASpecificHeader()
+	productID := nsh.ProductID
 	if l.IsImageFile() && productID >= 16 && productID <= 19 {
 		tmp := l.FindSecondaryHeader(SegmentIdentificationHeaderType)
 		if tmp != nil {
@@ -0,0 +1,39 @@
+package lrit
+
+import (
+	"testing"
+)
+
+func TestFillRowWidth(t *testing.T) {
+	tests := []struct {
+		bpp  uint8
+		want int
+	}{
+		{8, 8},
+		{10, 16},
+		{16, 16},
+	}
+
+	for _, tt := range tests {
+		for _, policy := range []FillPolicy{FillZero, FillLastRow} {
+			f := &File{
+				SecondaryHeaders: []SecondaryHeader{ImageStructureHeader{Type: 1, Length: 9, BitsPerPixel: tt.bpp, NumCols: 8, NumRows: 4}},
+				Fill:             policy,
+			}
+			row, err := f.FillRow()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(row) != tt.want {
+				t.Errorf("%d bpp, %s: got a %d byte fill row, want %d", tt.bpp, policy, len(row), tt.want)
+			}
+
+			// Repeating the last row copies a whole row of pixels
+			f.Data = make([]byte, 3*tt.want)
+			f.Data[len(f.Data)-tt.want] = 0xaa
+			if row := f.GetFillRow(); len(row) != tt.want || row[0] != 0xaa {
+				t.Errorf("%d bpp: got last row %v, want %d bytes starting with 0xaa", tt.bpp, row, tt.want)
+			}
+		}
+	}
+}
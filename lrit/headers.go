@@ -34,6 +34,7 @@ const (
 type SecondaryHeader interface {
 	HeaderType() SecondaryHeaderType
 	HeaderLength() uint16
+	MarshalBinary() ([]byte, error)
 }
 
 type ImageStructureHeader struct {
@@ -70,7 +71,7 @@ type AnnotationHeader struct {
 type TimestampHeader struct {
 	Type   uint8
 	Length uint16
-	Time   uint64 //TODO: Maybe change this to a time.Time
+	Time   uint64 // Raw CDS time code, including its P-field. See Timestamp()
 }
 
 type AncillaryTextHeader struct {
@@ -82,6 +83,7 @@ type AncillaryTextHeader struct {
 type KeyHeader struct {
 	Type   uint8 //Used to control compression. Ignore if Type == 7
 	Length uint16
+	Key    []byte // Not decoded, but kept so the header can be written back out
 }
 
 type SegmentIdentificationHeader struct {
@@ -126,26 +128,30 @@ type DCSFilenameHeader struct {
 	Filename string
 }
 
+// A header of a type this package doesn't know about, kept as raw bytes
+type UnknownHeader struct {
+	Type   uint8
+	Length uint16
+	Data   []byte
+}
+
 func (f *File) GetImageStructureHeader() (ImageStructureHeader, error) {
-	tmpish := f.FindSecondaryHeader(ImageStructureHeaderType)
-	if tmpish != nil {
-		return tmpish.(ImageStructureHeader), nil
+	if ish, ok := f.FindSecondaryHeader(ImageStructureHeaderType).(ImageStructureHeader); ok {
+		return ish, nil
 	}
 	return ImageStructureHeader{}, fmt.Errorf("Could not find Image Structure Header")
 }
 
 func (f *File) GetRiceCompressionHeader() (RiceCompressionHeader, error) {
-	tmprch := f.FindSecondaryHeader(RiceCompressionHeaderType)
-	if tmprch != nil {
-		return tmprch.(RiceCompressionHeader), nil
+	if rch, ok := f.FindSecondaryHeader(RiceCompressionHeaderType).(RiceCompressionHeader); ok {
+		return rch, nil
 	}
 	return RiceCompressionHeader{}, fmt.Errorf("Could not find Rice Compression Header")
 }
 
 func (f *File) GetNOAASpecificHeader() (NOAASpecificHeader, error) {
-	tmpnsh := f.FindSecondaryHeader(NOAASpecificHeaderType)
-	if tmpnsh != nil {
-		return tmpnsh.(NOAASpecificHeader), nil
+	if nsh, ok := f.FindSecondaryHeader(NOAASpecificHeaderType).(NOAASpecificHeader); ok {
+		return nsh, nil
 	}
 	return NOAASpecificHeader{}, fmt.Errorf("Could not find Rice Compression Header")
 }
@@ -166,75 +172,64 @@ func (h PrimaryHeader) IsValid() bool {
 	return true
 }
 
+// Parses the secondary headers from the front of Data, and leaves just the payload in Data
 func (l *File) PopulateSecondaryHeaders() error {
-	if uint32(len(l.Data))-l.PrimaryHeader.AllHeaderLength <= uint32(0) {
+	headerlen := int(l.PrimaryHeader.AllHeaderLength) - int(l.PrimaryHeader.Length)
+	if headerlen < 0 || headerlen > len(l.Data) {
 		return fmt.Errorf("Not enough data to process all headers!")
 	}
-	headerlen := int(l.PrimaryHeader.AllHeaderLength) - int(l.PrimaryHeader.Length)
-	for headerlen > 0 {
-		if sh, raw, err := getNextHeader(l.Data); err == nil {
-			l.SecondaryHeaders = append(l.SecondaryHeaders, sh)
-			l.RawHeaders = append(l.RawHeaders, raw...)
-			headerlen -= int(sh.HeaderLength())
-			l.Data = l.Data[sh.HeaderLength():]
-		} else {
-			return err
-		}
+	sh, err := parseHeaderRegion(l.Data[:headerlen], int(l.PrimaryHeader.Length))
+	if err != nil {
+		return err
 	}
+	l.SecondaryHeaders = append(l.SecondaryHeaders, sh...)
+	l.RawHeaders = append(l.RawHeaders, l.Data[:headerlen]...)
+	l.Data = l.Data[headerlen:]
+	l.SecondaryHeadersPopulated = true
 	return nil
 }
 
-func MakeImageStructureHeader(ph PrimaryHeader, data []byte) ImageStructureHeader {
-	curhtype := data[0]
-	for SecondaryHeaderType(curhtype) != ImageStructureHeaderType && len(data) >= 3 {
-		headerlen := (uint16(data[1]) << 8) | uint16(data[2])
-		if headerlen > uint16(len(data)) {
-			log.Errorf("Could not find Image Structure Header")
-			return ImageStructureHeader{}
+// Walks the secondary headers at the start of data until it finds one of the given type
+func findHeader(data []byte, htype SecondaryHeaderType) (SecondaryHeader, error) {
+	for len(data) >= 3 {
+		sh, raw, err := getNextHeader(data)
+		if err != nil {
+			return nil, err
 		}
-		data = data[headerlen:]
-	}
-
-	if len(data) <= 3 {
-		return ImageStructureHeader{}
+		if sh.HeaderType() == htype {
+			return sh, nil
+		}
+		data = data[len(raw):]
 	}
+	return nil, fmt.Errorf("Could not find secondary header type %d", htype)
+}
 
-	htype := data[0]
-	headerlen := (uint16(data[1]) << 8) | uint16(data[2])
-	return ImageStructureHeader{
-		Type:         htype,
-		Length:       headerlen,
-		BitsPerPixel: data[3],
-		NumCols:      (uint16(data[4]) << 8) | uint16(data[5]),
-		NumRows:      (uint16(data[6]) << 8) | uint16(data[7]),
-		IsCompressed: data[8],
+func MakeImageStructureHeader(ph PrimaryHeader, data []byte) ImageStructureHeader {
+	sh, err := findHeader(data, ImageStructureHeaderType)
+	if ish, ok := sh.(ImageStructureHeader); err == nil && ok {
+		return ish
 	}
+	log.Errorf("Could not find Image Structure Header")
+	return ImageStructureHeader{}
 }
 
 func MakeRiceCompressionHeader(ph PrimaryHeader, data []byte) RiceCompressionHeader {
-	curhtype := data[0]
-	for SecondaryHeaderType(curhtype) != RiceCompressionHeaderType && len(data) >= 3 {
-		headerlen := (uint16(data[1]) << 8) | uint16(data[2])
-		if headerlen > uint16(len(data)) {
-			log.Errorf("Could not find Rice Compression Header")
-			return RiceCompressionHeader{}
-		}
-		data = data[headerlen:]
-	}
-
-	if len(data) <= 3 {
-		return RiceCompressionHeader{}
+	sh, err := findHeader(data, RiceCompressionHeaderType)
+	if rch, ok := sh.(RiceCompressionHeader); err == nil && ok {
+		return rch
 	}
+	log.Errorf("Could not find Rice Compression Header")
+	return RiceCompressionHeader{}
+}
 
-	htype := data[0]
-	headerlen := (uint16(data[1]) << 8) | uint16(data[2])
-	return RiceCompressionHeader{
-		Type:               htype,
-		Length:             headerlen,
-		Flags:              (uint16(data[3]) << 8) | uint16(data[4]),
-		PixelsPerBlock:     data[5],
-		ScanlinesPerPacket: data[6],
-	}
+// Shortest valid length of each fixed layout header, including the 3 byte type and length
+var minHeaderLength = map[SecondaryHeaderType]uint16{
+	ImageStructureHeaderType:        9,
+	ImageNavigationHeaderType:       51,
+	TimestampHeaderType:             10,
+	SegmentIdentificationHeaderType: 17,
+	NOAASpecificHeaderType:          14,
+	RiceCompressionHeaderType:       7,
 }
 
 func getNextHeader(data []byte) (SecondaryHeader, []byte, error) {
@@ -244,6 +239,16 @@ func getNextHeader(data []byte) (SecondaryHeader, []byte, error) {
 
 	htype := data[0]
 	headerlen := (uint16(data[1]) << 8) | uint16(data[2])
+	if headerlen < 3 {
+		return nil, []byte{}, fmt.Errorf("Invalid length %d for header type %d", headerlen, htype)
+	}
+	if int(headerlen) > len(data) {
+		return nil, []byte{}, fmt.Errorf("Header type %d is %d bytes long, but only %d are left", htype, headerlen, len(data))
+	}
+	if min, ok := minHeaderLength[SecondaryHeaderType(htype)]; ok && headerlen < min {
+		return nil, []byte{}, fmt.Errorf("Header type %d is too short: %d bytes, want at least %d", htype, headerlen, min)
+	}
+	data = data[:headerlen]
 
 	switch SecondaryHeaderType(htype) {
 	case ImageStructureHeaderType:
@@ -254,7 +259,7 @@ func getNextHeader(data []byte) (SecondaryHeader, []byte, error) {
 			NumCols:      (uint16(data[4]) << 8) | uint16(data[5]),
 			NumRows:      (uint16(data[6]) << 8) | uint16(data[7]),
 			IsCompressed: data[8],
-		}, data[:headerlen], nil
+		}, data, nil
 	case ImageNavigationHeaderType:
 		return ImageNavigationHeader{
 			Type:                htype,
@@ -264,39 +269,37 @@ func getNextHeader(data []byte) (SecondaryHeader, []byte, error) {
 			LineScalingFactor:   (uint32(data[39]) << 24) | (uint32(data[40]) << 16) | (uint32(data[41]) << 8) | uint32(data[42]),
 			ColumnOffset:        (uint32(data[43]) << 24) | (uint32(data[44]) << 16) | (uint32(data[45]) << 8) | uint32(data[46]),
 			LineOffset:          (uint32(data[47]) << 24) | (uint32(data[48]) << 16) | (uint32(data[49]) << 8) | uint32(data[50]),
-		}, data[:headerlen], nil
+		}, data, nil
 	case ImageDataFunctionHeaderType:
-		headerlen := (uint16(data[1]) << 8) | uint16(data[2])
 		return ImageDataFunctionHeader{
 			Type:           htype,
 			Length:         headerlen,
-			DataDefinition: string(data[3:headerlen]), // TODO: might need to be either -2 or -4?
-		}, data[:headerlen], nil
+			DataDefinition: string(data[3:]),
+		}, data, nil
 	case AnnotationHeaderType:
-		headerlen := (uint16(data[1]) << 8) | uint16(data[2])
 		return AnnotationHeader{
 			Type:   htype,
 			Length: headerlen,
-			Text:   string(data[3:headerlen]),
-		}, data[:headerlen], nil
+			Text:   string(data[3:]),
+		}, data, nil
 	case TimestampHeaderType:
 		return TimestampHeader{
 			Type:   htype,
 			Length: headerlen,
 			Time:   (uint64(data[3]) << 48) | (uint64(data[4]) << 40) | (uint64(data[5]) << 32) | (uint64(data[6]) << 24) | (uint64(data[7]) << 16) | (uint64(data[8]) << 8) | uint64(data[9]),
-		}, data[:headerlen], nil
+		}, data, nil
 	case AncillaryTextHeaderType:
-		headerlen := (uint16(data[1]) << 8) | uint16(data[2])
 		return AncillaryTextHeader{
 			Type:   htype,
 			Length: headerlen,
-			Text:   string(data[3:headerlen]),
-		}, data[:headerlen], nil
+			Text:   string(data[3:]),
+		}, data, nil
 	case KeyHeaderType:
 		return KeyHeader{
 			Type:   htype,
 			Length: headerlen,
-		}, data[:headerlen], nil
+			Key:    append([]byte{}, data[3:]...),
+		}, data, nil
 	case SegmentIdentificationHeaderType:
 		return SegmentIdentificationHeader{
 			Type:            htype,
@@ -308,7 +311,7 @@ func getNextHeader(data []byte) (SecondaryHeader, []byte, error) {
 			MaxSegment:      (uint16(data[11]) << 8) | uint16(data[12]),
 			MaxColumn:       (uint16(data[13]) << 8) | uint16(data[14]),
 			MaxRow:          (uint16(data[15]) << 8) | uint16(data[16]),
-		}, data[:headerlen], nil
+		}, data, nil
 	case NOAASpecificHeaderType:
 		return NOAASpecificHeader{
 			Type:                    htype,
@@ -318,13 +321,13 @@ func getNextHeader(data []byte) (SecondaryHeader, []byte, error) {
 			ProductSubID:            (uint16(data[9]) << 8) | uint16(data[10]),
 			Parameter:               (uint16(data[11]) << 8) | uint16(data[12]),
 			NOAASpecificCompression: data[13],
-		}, data[:headerlen], nil
+		}, data, nil
 	case HeaderStructureRecordHeaderType:
 		return HeaderStructureRecordHeader{
 			Type:      htype,
 			Length:    headerlen,
-			Structure: string(data[3:headerlen]),
-		}, data[:headerlen], nil
+			Structure: string(data[3:]),
+		}, data, nil
 	case RiceCompressionHeaderType:
 		return RiceCompressionHeader{
 			Type:               htype,
@@ -332,40 +335,36 @@ func getNextHeader(data []byte) (SecondaryHeader, []byte, error) {
 			Flags:              (uint16(data[3]) << 8) | uint16(data[4]),
 			PixelsPerBlock:     data[5],
 			ScanlinesPerPacket: data[6],
-		}, data[:headerlen], nil
+		}, data, nil
 	case DCSFilenameHeaderType:
 		return DCSFilenameHeader{
 			Type:     htype,
 			Length:   headerlen,
-			Filename: string(data[3:headerlen]),
-		}, data[:headerlen], nil
+			Filename: string(data[3:]),
+		}, data, nil
 	default:
-		return nil, []byte{}, fmt.Errorf("Invalid header type found in header! (type = %d)", htype)
+		return UnknownHeader{
+			Type:   htype,
+			Length: headerlen,
+			Data:   append([]byte{}, data[3:]...),
+		}, data, nil
 	}
 }
 
 func MakeSecondaryHeaders(data []byte, ph PrimaryHeader) ([]SecondaryHeader, []byte, error) {
-	var ret []SecondaryHeader
-	var rawh []byte
-
-	if uint32(len(data))-ph.AllHeaderLength <= uint32(0) {
-		return ret, rawh, fmt.Errorf("Not enough data to make all secondary headers!")
+	if ph.Length != PrimaryHeaderLength || uint32(ph.Length) > ph.AllHeaderLength {
+		return []SecondaryHeader{}, []byte{}, fmt.Errorf("Invalid header lengths in primary header: %d/%d", ph.Length, ph.AllHeaderLength)
+	}
+	if uint64(len(data)) < uint64(ph.AllHeaderLength) {
+		return []SecondaryHeader{}, []byte{}, fmt.Errorf("Not enough data to make all secondary headers!")
 	}
 
-	headerlen := int(ph.AllHeaderLength) - int(ph.Length)
-
-	data = data[ph.Length:]
-	for headerlen > 0 {
-		if sh, raw, err := getNextHeader(data); err == nil {
-			ret = append(ret, sh)
-			rawh = append(rawh, raw...)
-			headerlen -= int(sh.HeaderLength())
-			data = data[sh.HeaderLength():]
-		} else {
-			return []SecondaryHeader{}, []byte{}, err
-		}
+	region := data[ph.Length:ph.AllHeaderLength]
+	sh, err := parseHeaderRegion(region, int(ph.Length))
+	if err != nil {
+		return []SecondaryHeader{}, []byte{}, err
 	}
-	return ret, rawh, nil
+	return sh, region, nil
 }
 
 func MakePrimaryHeader(data []byte) (PrimaryHeader, error) {
@@ -0,0 +1,38 @@
+package lrit
+
+import (
+	"testing"
+)
+
+func FuzzMakeSecondaryHeaders(f *testing.F) {
+	var headers []byte
+	for _, h := range [][]byte{
+		rawHeader(1, 8, 0x03, 0x52, 0x00, 0x4b, 1),
+		rawHeader(4, []byte("OR_ABI-L2-CMIPF-M6C13_G16_s20241001200208.lrit")...),
+		rawHeader(5, 0x40, 0x5e, 0x8c, 0x02, 0x9a, 0x7e, 0xf0),
+		rawHeader(128, 0x00, 0x2a, 0x00, 0x03, 0x00, 0x00, 0x00, 0x96, 0x00, 0x0a, 0x03, 0x52, 0x04, 0x1a),
+		rawHeader(129, 'N', 'O', 'A', 'A', 0x00, 0x10, 0x00, 0x0d, 0x00, 0x01, 1),
+		rawHeader(131, 0x00, 0x31, 16, 1),
+	} {
+		headers = append(headers, h...)
+	}
+	ph, _ := PrimaryHeader{AllHeaderLength: uint32(PrimaryHeaderLength + len(headers))}.MarshalBinary()
+	f.Add(append(ph, headers...))
+	// Truncated part way through a header
+	f.Add(append(ph, headers[:20]...))
+	// Zero length headers, and fixed layout headers that are shorter than their fields
+	f.Add(append(ph, 1, 0, 0))
+	f.Add(append(ph, 2, 0, 3))
+	f.Add(append(ph, 131, 0, 5, 0, 0))
+	f.Add(ph[:8])
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ph, err := MakePrimaryHeader(data)
+		if err != nil {
+			return
+		}
+		MakeSecondaryHeaders(data, ph)
+		MakeImageStructureHeader(ph, data[min(len(data), PrimaryHeaderLength):])
+		MakeRiceCompressionHeader(ph, data[min(len(data), PrimaryHeaderLength):])
+	})
+}
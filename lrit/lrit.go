@@ -5,6 +5,9 @@ import (
 	"os"
 	"slices"
 	"strings"
+	"time"
+
+	"github.com/jrwynneiii/ccsds_tools/packets"
 )
 
 type File struct {
@@ -20,6 +23,27 @@ type File struct {
 	RawHeaders                []byte
 	SecondaryHeadersPopulated bool
 	PrimaryHeaderPopulated    bool
+	Quality                   packets.QualitySummary
+	SCID                      uint16
+	Satellite                 string
+
+	// Reassembly policy, set by the transport layer
+	ContinueOnCRCFailure bool
+	Fill                 FillPolicy
+	CorruptSDUs          int
+	FilledRows           int
+	SDUsReceived         int
+	// Rows of a Rice compressed image that were decompressed, rather than filled in
+	RecoveredRows int
+	// Set once the headers show the file is a Rice compressed image
+	Rice *RiceStream
+
+	StartedAt   time.Time
+	LastUpdated time.Time
+	// Set when the transport layer gave up waiting for the rest of the file. Completeness is the percentage of the
+	// file's data that was actually received
+	Incomplete   bool
+	Completeness float64
 }
 
 var (
@@ -29,24 +53,17 @@ var (
 )
 
 func NewExistingFile(path string) (*File, error) {
-	if data, err := os.ReadFile(path); err == nil {
-		ph, _ := MakePrimaryHeader(data)
-		headers := data[:16]
-		data = data[16:]
-		lf := File{
-			PrimaryHeader: ph,
-			Data:          data,
-			CRCGood:       true,
-			RawHeaders:    headers,
-		}
-
-		if err = lf.PopulateSecondaryHeaders(); err != nil {
-			return nil, fmt.Errorf("Could not parse LRIT file headers (%s): %s", path, err.Error())
-		}
-		return &lf, nil
-	} else {
+	r, err := os.Open(path)
+	if err != nil {
 		return nil, fmt.Errorf("Can not read LRIT file %s", path)
 	}
+	defer r.Close()
+
+	lf, err := Open(r, OpenOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse LRIT file headers (%s): %w", path, err)
+	}
+	return lf, nil
 }
 
 func (l File) IsImageFile() bool {
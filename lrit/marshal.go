@@ -0,0 +1,190 @@
+package lrit
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Encoders for LRIT headers and files; the inverse of MakePrimaryHeader() and getNextHeader(). Variable length headers
+// get their length recomputed from their contents, so headers can be edited before being marshalled
+
+const PrimaryHeaderLength = 16
+
+func (h PrimaryHeader) MarshalBinary() ([]byte, error) {
+	b := []byte{h.Type}
+	b = binary.BigEndian.AppendUint16(b, PrimaryHeaderLength)
+	b = append(b, h.FileType)
+	b = binary.BigEndian.AppendUint32(b, h.AllHeaderLength)
+	b = binary.BigEndian.AppendUint64(b, h.DataLength)
+	return b, nil
+}
+
+// Starts off a secondary header with its type and length
+func headerPrefix(htype SecondaryHeaderType, length int) ([]byte, error) {
+	if length > 0xffff {
+		return nil, fmt.Errorf("Secondary header type %d is too long: %d bytes", htype, length)
+	}
+	b := make([]byte, 0, length)
+	b = append(b, uint8(htype))
+	return binary.BigEndian.AppendUint16(b, uint16(length)), nil
+}
+
+func marshalTextHeader(htype SecondaryHeaderType, text string) ([]byte, error) {
+	b, err := headerPrefix(htype, 3+len(text))
+	if err != nil {
+		return nil, err
+	}
+	return append(b, text...), nil
+}
+
+// Pads or truncates a string to a fixed width field
+func fixedString(s string, n int) []byte {
+	b := make([]byte, n)
+	copy(b, s)
+	return b
+}
+
+func (h ImageStructureHeader) MarshalBinary() ([]byte, error) {
+	b, _ := headerPrefix(ImageStructureHeaderType, 9)
+	b = append(b, h.BitsPerPixel)
+	b = binary.BigEndian.AppendUint16(b, h.NumCols)
+	b = binary.BigEndian.AppendUint16(b, h.NumRows)
+	return append(b, h.IsCompressed), nil
+}
+
+func (h ImageNavigationHeader) MarshalBinary() ([]byte, error) {
+	b, _ := headerPrefix(ImageNavigationHeaderType, 51)
+	b = append(b, fixedString(h.ProjectionName, 32)...)
+	b = binary.BigEndian.AppendUint32(b, h.ColumnScalingFactor)
+	b = binary.BigEndian.AppendUint32(b, h.LineScalingFactor)
+	b = binary.BigEndian.AppendUint32(b, h.ColumnOffset)
+	return binary.BigEndian.AppendUint32(b, h.LineOffset), nil
+}
+
+func (h ImageDataFunctionHeader) MarshalBinary() ([]byte, error) {
+	return marshalTextHeader(ImageDataFunctionHeaderType, h.DataDefinition)
+}
+
+func (h AnnotationHeader) MarshalBinary() ([]byte, error) {
+	return marshalTextHeader(AnnotationHeaderType, h.Text)
+}
+
+func (h TimestampHeader) MarshalBinary() ([]byte, error) {
+	b, _ := headerPrefix(TimestampHeaderType, 10)
+	// The time field is 7 bytes
+	t := binary.BigEndian.AppendUint64(nil, h.Time)
+	return append(b, t[1:]...), nil
+}
+
+func (h AncillaryTextHeader) MarshalBinary() ([]byte, error) {
+	return marshalTextHeader(AncillaryTextHeaderType, h.Text)
+}
+
+func (h KeyHeader) MarshalBinary() ([]byte, error) {
+	b, err := headerPrefix(KeyHeaderType, 3+len(h.Key))
+	if err != nil {
+		return nil, err
+	}
+	return append(b, h.Key...), nil
+}
+
+func (h SegmentIdentificationHeader) MarshalBinary() ([]byte, error) {
+	b, _ := headerPrefix(SegmentIdentificationHeaderType, 17)
+	for _, v := range []uint16{h.ImageIdentifier, h.SequenceNumber, h.StartColumn, h.StartLine, h.MaxSegment, h.MaxColumn, h.MaxRow} {
+		b = binary.BigEndian.AppendUint16(b, v)
+	}
+	return b, nil
+}
+
+func (h NOAASpecificHeader) MarshalBinary() ([]byte, error) {
+	b, _ := headerPrefix(NOAASpecificHeaderType, 14)
+	b = append(b, fixedString(h.Agency, 4)...)
+	b = binary.BigEndian.AppendUint16(b, h.ProductID)
+	b = binary.BigEndian.AppendUint16(b, h.ProductSubID)
+	b = binary.BigEndian.AppendUint16(b, h.Parameter)
+	return append(b, h.NOAASpecificCompression), nil
+}
+
+func (h HeaderStructureRecordHeader) MarshalBinary() ([]byte, error) {
+	return marshalTextHeader(HeaderStructureRecordHeaderType, h.Structure)
+}
+
+func (h RiceCompressionHeader) MarshalBinary() ([]byte, error) {
+	b, _ := headerPrefix(RiceCompressionHeaderType, 7)
+	b = binary.BigEndian.AppendUint16(b, h.Flags)
+	return append(b, h.PixelsPerBlock, h.ScanlinesPerPacket), nil
+}
+
+func (h DCSFilenameHeader) MarshalBinary() ([]byte, error) {
+	return marshalTextHeader(DCSFilenameHeaderType, h.Filename)
+}
+
+func (h UnknownHeader) MarshalBinary() ([]byte, error) {
+	b, err := headerPrefix(SecondaryHeaderType(h.Type), 3+len(h.Data))
+	if err != nil {
+		return nil, err
+	}
+	return append(b, h.Data...), nil
+}
+
+// Encodes all of the file's headers, with the primary header's lengths updated to match
+func (f *File) MarshalHeaders() ([]byte, error) {
+	var secondary []byte
+	for _, sh := range f.SecondaryHeaders {
+		b, err := sh.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		secondary = append(secondary, b...)
+	}
+
+	ph := f.PrimaryHeader
+	ph.AllHeaderLength = uint32(PrimaryHeaderLength + len(secondary))
+	ph.DataLength = uint64(len(f.Payload())) * 8
+	b, _ := ph.MarshalBinary()
+	return append(b, secondary...), nil
+}
+
+// Encodes the file as it would be written to disk: its headers, followed by its (decompressed) data
+func (f *File) MarshalBinary() ([]byte, error) {
+	if !f.PrimaryHeaderPopulated && len(f.SecondaryHeaders) == 0 {
+		return nil, fmt.Errorf("Can't marshal LRIT file without headers")
+	}
+	b, err := f.MarshalHeaders()
+	if err != nil {
+		return nil, err
+	}
+	return append(b, f.Payload()...), nil
+}
+
+// The file's data, without its headers
+func (f *File) Payload() []byte {
+	if len(f.Data) > 0 || !f.PrimaryHeaderPopulated {
+		return f.Data
+	}
+	if uint64(len(f.RawData)) > uint64(f.PrimaryHeader.AllHeaderLength) {
+		return f.RawData[f.PrimaryHeader.AllHeaderLength:]
+	}
+	return []byte{}
+}
+
+// Replaces the file's secondary header of the same type, or adds it if the file doesn't have one
+func (f *File) SetSecondaryHeader(h SecondaryHeader) {
+	for i, sh := range f.SecondaryHeaders {
+		if sh.HeaderType() == h.HeaderType() {
+			f.SecondaryHeaders[i] = h
+			return
+		}
+	}
+	f.SecondaryHeaders = append(f.SecondaryHeaders, h)
+}
+
+func (f *File) RemoveSecondaryHeader(htype SecondaryHeaderType) {
+	var kept []SecondaryHeader
+	for _, sh := range f.SecondaryHeaders {
+		if sh.HeaderType() != htype {
+			kept = append(kept, sh)
+		}
+	}
+	f.SecondaryHeaders = kept
+}
@@ -0,0 +1,105 @@
+package lrit
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func rawHeader(htype uint8, body ...byte) []byte {
+	length := 3 + len(body)
+	return append([]byte{htype, byte(length >> 8), byte(length)}, body...)
+}
+
+func TestSecondaryHeaderRoundTrip(t *testing.T) {
+	projection := append([]byte("geos(-75.0)"), make([]byte, 21)...)
+	tests := []struct {
+		name string
+		raw  []byte
+	}{
+		{"image structure", rawHeader(1, 8, 0x03, 0x52, 0x00, 0x4b, 1)},
+		{"image navigation", rawHeader(2, append(projection,
+			0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f)...)},
+		{"image data function", rawHeader(3, []byte("$HALFTONE:=8\r\n_NAME:=toa_brightness_temperature")...)},
+		{"annotation", rawHeader(4, []byte("OR_ABI-L2-CMIPF-M6C13_G16_s20241001200208_e20241001209516_c20241001209576.lrit")...)},
+		{"timestamp", rawHeader(5, 0x40, 0x5e, 0x8c, 0x02, 0x9a, 0x7e, 0xf0)},
+		{"ancillary text", rawHeader(6, []byte("Time of frame start = 2024-04-10T12:00:20.8Z;Satellite = G16")...)},
+		{"key", rawHeader(7, 0xde, 0xad, 0xbe, 0xef, 0x01)},
+		{"empty key", rawHeader(7)},
+		{"segment identification", rawHeader(128, 0x00, 0x2a, 0x00, 0x03, 0x00, 0x00, 0x00, 0x96, 0x00, 0x0a, 0x03, 0x52, 0x04, 0x1a)},
+		{"NOAA specific", rawHeader(129, 'N', 'O', 'A', 'A', 0x00, 0x10, 0x00, 0x0d, 0x00, 0x01, 1)},
+		{"header structure record", rawHeader(130, []byte("$HALFTONE:=8\r\n")...)},
+		{"Rice compression", rawHeader(131, 0x00, 0x31, 16, 1)},
+		{"DCS filename", rawHeader(132, []byte("pM-24101120015-A.dcs")...)},
+		{"unknown", rawHeader(200, 0x01, 0x02, 0x03)},
+		{"empty unknown", rawHeader(8)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sh, raw, err := getNextHeader(tt.raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(raw, tt.raw) {
+				t.Fatalf("parsed %d bytes, want %d", len(raw), len(tt.raw))
+			}
+			if sh.HeaderType() != SecondaryHeaderType(tt.raw[0]) {
+				t.Errorf("got header type %d, want %d", sh.HeaderType(), tt.raw[0])
+			}
+
+			b, err := sh.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, tt.raw) {
+				t.Errorf("marshalled to % x, want % x", b, tt.raw)
+			}
+
+			again, _, err := getNextHeader(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(again, sh) {
+				t.Errorf("parsed back as %+v, want %+v", again, sh)
+			}
+		})
+	}
+}
+
+func TestFileRoundTrip(t *testing.T) {
+	var raw []byte
+	for _, h := range [][]byte{
+		rawHeader(1, 8, 0x00, 0x04, 0x00, 0x02, 0),
+		rawHeader(4, []byte("OR_ABI-L2-CMIPF-M6C13_G16_s20241001200208.lrit")...),
+		rawHeader(5, 0x40, 0x5e, 0x8c, 0x02, 0x9a, 0x7e, 0xf0),
+		rawHeader(7, 0x01, 0x02, 0x03),
+		rawHeader(129, 'N', 'O', 'A', 'A', 0x00, 0x10, 0x00, 0x0d, 0x00, 0x01, 0),
+		rawHeader(201, 0xff),
+	} {
+		raw = append(raw, h...)
+	}
+	data := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	ph, _ := PrimaryHeader{FileType: 0, AllHeaderLength: uint32(PrimaryHeaderLength + len(raw)), DataLength: uint64(len(data)) * 8}.MarshalBinary()
+	file := append(append(ph, raw...), data...)
+
+	f, err := Open(bytes.NewReader(file), OpenOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, file) {
+		t.Errorf("marshalled to % x, want % x", b, file)
+	}
+
+	again, err := Open(bytes.NewReader(b), OpenOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again.SecondaryHeaders, f.SecondaryHeaders) || again.PrimaryHeader != f.PrimaryHeader {
+		t.Errorf("parsed back as %+v %+v, want %+v %+v", again.PrimaryHeader, again.SecondaryHeaders, f.PrimaryHeader, f.SecondaryHeaders)
+	}
+}
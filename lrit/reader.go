@@ -0,0 +1,178 @@
+package lrit
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/charmbracelet/log"
+)
+
+var (
+	LRITTruncatedErr       error = fmt.Errorf("LRIT file truncated")
+	LRITMalformedHeaderErr error = fmt.Errorf("Malformed LRIT header")
+)
+
+// Returned when a file ends before its headers or data do. Matches LRITTruncatedErr with errors.Is()
+type TruncatedError struct {
+	Section string
+	Have    uint64
+	Want    uint64
+}
+
+func (e *TruncatedError) Error() string {
+	return fmt.Sprintf("%s: %s has %d bytes, want %d", LRITTruncatedErr.Error(), e.Section, e.Have, e.Want)
+}
+
+func (e *TruncatedError) Unwrap() error {
+	return LRITTruncatedErr
+}
+
+// Returned when a header can't be parsed. Offset is from the start of the file. Matches LRITMalformedHeaderErr with
+// errors.Is()
+type MalformedHeaderError struct {
+	Offset int
+	Type   uint8
+	Reason string
+}
+
+func (e *MalformedHeaderError) Error() string {
+	return fmt.Sprintf("%s (type %d at offset %d): %s", LRITMalformedHeaderErr.Error(), e.Type, e.Offset, e.Reason)
+}
+
+func (e *MalformedHeaderError) Unwrap() error {
+	return LRITMalformedHeaderErr
+}
+
+type OpenOptions struct {
+	// Decompress Rice compressed images. The image and NOAA specific headers are updated to say the data is no longer
+	// compressed, and the Rice compression header is removed
+	DecompressRice bool
+	// Extract ZIP payloads into UnzippedData
+	Unzip bool
+}
+
+// Reads a complete LRIT file, as written to disk or sent over the air
+func Open(r io.Reader, opts OpenOptions) (*File, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	ph, err := MakePrimaryHeader(data)
+	if err != nil {
+		return nil, &TruncatedError{Section: "primary header", Have: uint64(len(data)), Want: PrimaryHeaderLength}
+	}
+	if !ph.IsValid() || ph.Length != PrimaryHeaderLength {
+		return nil, &MalformedHeaderError{Offset: 0, Type: ph.Type, Reason: fmt.Sprintf("invalid primary header (length %d)", ph.Length)}
+	}
+	if ph.AllHeaderLength < PrimaryHeaderLength {
+		return nil, &MalformedHeaderError{Offset: 0, Type: ph.Type, Reason: fmt.Sprintf("total header length %d is shorter than the primary header", ph.AllHeaderLength)}
+	}
+	if uint64(ph.AllHeaderLength) > uint64(len(data)) {
+		return nil, &TruncatedError{Section: "headers", Have: uint64(len(data)), Want: uint64(ph.AllHeaderLength)}
+	}
+
+	f := &File{
+		PrimaryHeader:          ph,
+		PrimaryHeaderPopulated: true,
+		RawData:                data,
+		RawHeaders:             data[:ph.AllHeaderLength],
+		Data:                   data[ph.AllHeaderLength:],
+		CRCGood:                true,
+		UnzippedData:           make(map[string][]byte),
+	}
+
+	if f.SecondaryHeaders, err = parseHeaderRegion(data[PrimaryHeaderLength:ph.AllHeaderLength], PrimaryHeaderLength); err != nil {
+		return nil, err
+	}
+	f.SecondaryHeadersPopulated = true
+
+	if want := ph.DataLength / 8; uint64(len(f.Data)) < want {
+		return f, &TruncatedError{Section: "data", Have: uint64(len(f.Data)), Want: want}
+	}
+
+	if opts.DecompressRice && f.IsImageFile() && f.IsRiceCompressed() {
+		if err := f.decompressRice(); err != nil {
+			return f, err
+		}
+	}
+
+	if opts.Unzip && f.ContainsZipArchive() {
+		if err := f.Unzip(); err != nil {
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+// Parses the secondary headers in exactly the given bytes. Offset is where they start in the file, for errors
+func parseHeaderRegion(region []byte, offset int) ([]SecondaryHeader, error) {
+	var ret []SecondaryHeader
+	for len(region) > 0 {
+		sh, raw, err := getNextHeader(region)
+		if err != nil {
+			return ret, &MalformedHeaderError{Offset: offset, Type: region[0], Reason: err.Error()}
+		}
+		ret = append(ret, sh)
+		region = region[len(raw):]
+		offset += len(raw)
+	}
+	return ret, nil
+}
+
+// Where the first header of the given type starts in the file
+func (f *File) headerOffset(t SecondaryHeaderType) int {
+	offset := PrimaryHeaderLength
+	for _, sh := range f.SecondaryHeaders {
+		if sh.HeaderType() == t {
+			break
+		}
+		offset += int(sh.HeaderLength())
+	}
+	return offset
+}
+
+func (f *File) decompressRice() error {
+	ish, err := f.GetImageStructureHeader()
+	if err != nil {
+		return err
+	}
+	rch, err := f.GetRiceCompressionHeader()
+	if err != nil {
+		return err
+	}
+
+	// Files written out after reassembly have already been decompressed, but keep their original headers
+	if len(f.Data) != rowBytes(ish)*int(ish.NumRows) {
+		stream := NewRiceStream(ish, rch)
+		if min := stream.MinLength(); len(f.Data) < min {
+			return &MalformedHeaderError{
+				Offset: f.headerOffset(ImageStructureHeaderType),
+				Type:   uint8(ImageStructureHeaderType),
+				Reason: fmt.Sprintf("%dx%d image can't be compressed into %d bytes, it needs at least %d", ish.NumCols, ish.NumRows, len(f.Data), min),
+			}
+		}
+		d, err := stream.DecodeAll(f.Data)
+		if err != nil {
+			return fmt.Errorf("Rice decompress failed: %s", err.Error())
+		}
+		f.Data = d
+	} else {
+		log.Debugf("%s is marked as Rice compressed, but is already the size of the decompressed image", f.GetName())
+	}
+
+	ish.IsCompressed = 0
+	f.SetSecondaryHeader(ish)
+	if nsh, err := f.GetNOAASpecificHeader(); err == nil {
+		nsh.NOAASpecificCompression = 0
+		f.SetSecondaryHeader(nsh)
+	}
+	f.RemoveSecondaryHeader(RiceCompressionHeaderType)
+
+	if f.RawHeaders, err = f.MarshalHeaders(); err != nil {
+		return err
+	}
+	f.PrimaryHeader, _ = MakePrimaryHeader(f.RawHeaders)
+	f.RawData = append(append([]byte{}, f.RawHeaders...), f.Data...)
+	return nil
+}
@@ -0,0 +1,112 @@
+package lrit
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// A 4 row, 8 column, 8 bit Rice compressed image, one row per packet. Row 2 is a single zero block, so the packets
+// aren't all the same length
+func riceTestImage() (*File, []byte) {
+	var packets, want []byte
+	for r := 0; r < 4; r++ {
+		w := &riceBitWriter{}
+		if r == 2 {
+			w.bits(3, 0)
+			w.bits(1, 0)
+			w.fs(0)
+			want = append(want, make([]byte, 8)...)
+		} else {
+			w.bits(3, 7)
+			for c := 0; c < 8; c++ {
+				w.bits(8, uint32(r*10+c))
+				want = append(want, byte(r*10+c))
+			}
+		}
+		packets = append(packets, w.data...)
+	}
+
+	f := &File{
+		PrimaryHeaderPopulated: true,
+		SecondaryHeaders: []SecondaryHeader{
+			ImageStructureHeader{BitsPerPixel: 8, NumCols: 8, NumRows: 4, IsCompressed: 1},
+			NOAASpecificHeader{Agency: "NOAA", ProductID: 16, NOAASpecificCompression: 1},
+			RiceCompressionHeader{Flags: RiceAllowK13Option | RiceMSBOption, PixelsPerBlock: 8, ScanlinesPerPacket: 1},
+		},
+		Data: packets,
+	}
+	return f, want
+}
+
+func TestOpenDecompressesEveryRiceRow(t *testing.T) {
+	src, want := riceTestImage()
+	b, err := src.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := Open(bytes.NewReader(b), OpenOptions{DecompressRice: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(f.Data, want) {
+		t.Errorf("got %d bytes %v, want %d bytes %v", len(f.Data), f.Data, len(want), want)
+	}
+	if f.IsRiceCompressed() || f.FindSecondaryHeader(RiceCompressionHeaderType) != nil {
+		t.Errorf("headers still say the image is compressed: %+v", f.SecondaryHeaders)
+	}
+	if f.PrimaryHeader.DataLength != uint64(len(want))*8 {
+		t.Errorf("data length is %d bits, want %d", f.PrimaryHeader.DataLength, len(want)*8)
+	}
+}
+
+func TestOpenRiceMissingRows(t *testing.T) {
+	src, _ := riceTestImage()
+	// Drop the last packet, which is 9 bytes long
+	src.Data = src.Data[:len(src.Data)-9]
+	b, err := src.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(bytes.NewReader(b), OpenOptions{DecompressRice: true}); err == nil {
+		t.Error("expected an error for an image with a row missing")
+	}
+}
+
+func TestOpenRiceImageTooBigForData(t *testing.T) {
+	src, _ := riceTestImage()
+	src.SecondaryHeaders[0] = ImageStructureHeader{BitsPerPixel: 16, NumCols: 65535, NumRows: 65535, IsCompressed: 1}
+	b, err := src.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Open(bytes.NewReader(b), OpenOptions{DecompressRice: true})
+	var mhe *MalformedHeaderError
+	if !errors.As(err, &mhe) || !errors.Is(err, LRITMalformedHeaderErr) {
+		t.Fatalf("got %v, want a malformed header error", err)
+	}
+	if mhe.Offset != PrimaryHeaderLength || mhe.Type != uint8(ImageStructureHeaderType) {
+		t.Errorf("error points at type %d at offset %d, want the image structure header", mhe.Type, mhe.Offset)
+	}
+}
+
+func FuzzOpen(f *testing.F) {
+	src, _ := riceTestImage()
+	if b, err := src.MarshalBinary(); err == nil {
+		f.Add(b)
+		// Truncated in the data, in the secondary headers and in the primary header
+		f.Add(b[:len(b)-5])
+		f.Add(b[:PrimaryHeaderLength+4])
+		f.Add(b[:10])
+	}
+	// A secondary header with a zero length
+	f.Add([]byte{0, 0, 16, 0, 0, 0, 0, 22, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0})
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		Open(bytes.NewReader(data), OpenOptions{DecompressRice: true, Unzip: true})
+	})
+}
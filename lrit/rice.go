@@ -0,0 +1,327 @@
+package lrit
+
+import (
+	"fmt"
+)
+
+// A native decoder for the CCSDS 121.0-B adaptive entropy coder ("Rice"), as used by szip. This decodes the same
+// streams as libaec's SZ_BufftoBuffDecompress(), with the options NOAA sends in the Rice compression header
+
+// szip option mask bits, as found in RiceCompressionHeader.Flags. As with libaec, only the NN and MSB options change
+// how data is decoded
+const (
+	RiceAllowK13Option = 1
+	RiceChipOption     = 2
+	RiceECOption       = 4
+	RiceLSBOption      = 8
+	RiceMSBOption      = 16
+	RiceNNOption       = 32
+	RiceRawOption      = 128
+)
+
+const (
+	// A zero block count of 5 means the rest of the segment (ROS)
+	riceROS = 5
+	// Blocks per segment, for ROS zero runs
+	riceSegmentBlocks = 64
+	// The largest second extension codeword libaec accepts
+	riceMaxSECodeword = 90
+)
+
+type riceBitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *riceBitReader) bits(n int) (uint32, error) {
+	if n == 0 {
+		return 0, nil
+	}
+	if r.pos+n > len(r.data)*8 {
+		return 0, fmt.Errorf("Rice data ended after %d bytes", len(r.data))
+	}
+	var v uint32
+	for i := 0; i < n; i++ {
+		bit := (r.data[r.pos>>3] >> (7 - uint(r.pos&7))) & 1
+		v = v<<1 | uint32(bit)
+		r.pos++
+	}
+	return v, nil
+}
+
+// Reads a fundamental sequence codeword: the number of zeros before the next one
+func (r *riceBitReader) fs() (uint32, error) {
+	var n uint32
+	for {
+		if r.pos >= len(r.data)*8 {
+			return 0, fmt.Errorf("Rice data ended after %d bytes", len(r.data))
+		}
+		if (r.data[r.pos>>3]>>(7-uint(r.pos&7)))&1 == 1 {
+			r.pos++
+			return n, nil
+		}
+		r.pos++
+		n++
+	}
+}
+
+type riceParams struct {
+	BitsPerSample int
+	BlockSize     int
+	// Reference sample interval, in blocks
+	RSI   int
+	Flags int
+}
+
+func (p riceParams) validate() error {
+	if p.BitsPerSample < 1 || p.BitsPerSample > 32 {
+		return fmt.Errorf("Unsupported Rice bits per pixel: %d", p.BitsPerSample)
+	}
+	// szip allows any even block size, not just the 8, 16, 32 and 64 from the standard
+	if p.BlockSize < 2 || p.BlockSize > 64 || p.BlockSize%2 != 0 {
+		return fmt.Errorf("Unsupported Rice pixels per block: %d", p.BlockSize)
+	}
+	if p.RSI < 1 || p.RSI > 4096 {
+		return fmt.Errorf("Unsupported Rice reference sample interval: %d blocks", p.RSI)
+	}
+	return nil
+}
+
+func (p riceParams) idLength() int {
+	switch {
+	case p.BitsPerSample > 16:
+		return 5
+	case p.BitsPerSample > 8:
+		return 4
+	}
+	return 3
+}
+
+// The largest value a sample can hold
+func (p riceParams) maxSample() uint32 {
+	return uint32(uint64(1)<<p.BitsPerSample - 1)
+}
+
+// Decodes count samples (a whole number of RSIs) from the stream. Preprocessed samples are returned as mapped
+// prediction residuals, with a raw reference sample at the start of each RSI
+func (p riceParams) decodeSamples(r *riceBitReader, count int) ([]uint32, error) {
+	n := p.BitsPerSample
+	j := p.BlockSize
+	preprocessed := p.Flags&RiceNNOption != 0
+	idLen := p.idLength()
+	idMax := uint32(1)<<idLen - 1
+	xmax := p.maxSample()
+
+	out := make([]uint32, 0, count)
+	for len(out) < count {
+		for b := 0; b < p.RSI; b++ {
+			ref := preprocessed && b == 0
+			refSamples := 0
+			if ref {
+				refSamples = 1
+			}
+
+			id, err := r.bits(idLen)
+			if err != nil {
+				return out, err
+			}
+
+			switch {
+			case id == 0:
+				ext, err := r.bits(1)
+				if err != nil {
+					return out, err
+				}
+				if ref {
+					v, err := r.bits(n)
+					if err != nil {
+						return out, err
+					}
+					out = append(out, v)
+				}
+
+				if ext == 1 {
+					// Second extension: pairs of samples coded together
+					for i := refSamples; i < j; {
+						m, err := r.fs()
+						if err != nil {
+							return out, err
+						}
+						if m > riceMaxSECodeword {
+							return out, fmt.Errorf("Invalid Rice second extension codeword: %d", m)
+						}
+						beta := uint32(0)
+						for (beta+1)*(beta+2)/2 <= m {
+							beta++
+						}
+						second := m - beta*(beta+1)/2
+						if max(beta-second, second) > xmax {
+							return out, fmt.Errorf("Rice second extension codeword %d is out of range for %d bits per pixel", m, n)
+						}
+						if i%2 == 0 {
+							out = append(out, beta-second)
+							i++
+						}
+						out = append(out, second)
+						i++
+					}
+					continue
+				}
+
+				fs, err := r.fs()
+				if err != nil {
+					return out, err
+				}
+				zeroBlocks := int(fs) + 1
+				if zeroBlocks == riceROS {
+					zeroBlocks = min(p.RSI-b, riceSegmentBlocks-b%riceSegmentBlocks)
+				} else if zeroBlocks > riceROS {
+					zeroBlocks--
+				}
+				if b+zeroBlocks > p.RSI {
+					return out, fmt.Errorf("Rice zero block run of %d overruns the reference sample interval", zeroBlocks)
+				}
+				out = append(out, make([]uint32, zeroBlocks*j-refSamples)...)
+				b += zeroBlocks - 1
+
+			case id == idMax:
+				// No compression. The reference sample is just the first sample
+				for i := 0; i < j; i++ {
+					v, err := r.bits(n)
+					if err != nil {
+						return out, err
+					}
+					out = append(out, v)
+				}
+
+			default:
+				// Split sample: a fundamental sequence for each sample's high bits, followed by k low bits for each
+				k := int(id) - 1
+				if ref {
+					v, err := r.bits(n)
+					if err != nil {
+						return out, err
+					}
+					out = append(out, v)
+				}
+				start := len(out)
+				for i := refSamples; i < j; i++ {
+					fs, err := r.fs()
+					if err != nil {
+						return out, err
+					}
+					if fs > xmax>>k {
+						return out, fmt.Errorf("Rice sample of at least %d is out of range for %d bits per pixel", uint64(fs)<<k, n)
+					}
+					out = append(out, fs<<k)
+				}
+				for i := start; i < len(out); i++ {
+					low, err := r.bits(k)
+					if err != nil {
+						return out, err
+					}
+					out[i] |= low
+					if out[i] > xmax {
+						return out, fmt.Errorf("Rice sample %d is out of range for %d bits per pixel", out[i], n)
+					}
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// Undoes the unit delay predictor and the residual mapping, one RSI at a time
+func (p riceParams) postprocess(samples []uint32) {
+	xmax := p.maxSample()
+	rsiSamples := p.RSI * p.BlockSize
+
+	for start := 0; start < len(samples); start += rsiSamples {
+		x := samples[start]
+		for i := start + 1; i < start+rsiSamples && i < len(samples); i++ {
+			d := samples[i]
+			theta := min(x, xmax-x)
+			switch {
+			case d <= 2*theta && d%2 == 0:
+				x += d / 2
+			case d <= 2*theta:
+				x -= (d + 1) / 2
+			case theta == x:
+				x = d
+			default:
+				x = xmax - d
+			}
+			samples[i] = x
+		}
+	}
+}
+
+// Decoded samples are stored in 1, 2 or 4 bytes
+func riceSampleBytes(bitsPerPixel int) int {
+	if bitsPerPixel > 16 {
+		return 4
+	} else if bitsPerPixel > 8 {
+		return 2
+	}
+	return 1
+}
+
+// Decodes lines scanlines of cols pixels each, and returns them along with how many bytes of data they took up. As
+// with szip, each scanline is its own reference sample interval, padded out to a whole number of blocks
+func riceDecompress(data []byte, bitsPerPixel, pixelsPerBlock, cols, lines, flags int) ([]byte, int, error) {
+	// szip codes 32 bit pixels as 8 bit samples, one byte plane after another
+	if bitsPerPixel == 32 {
+		planes, used, err := riceDecompress(data, 8, pixelsPerBlock, cols, lines*4, flags)
+		if err != nil {
+			return nil, used, err
+		}
+		pixels := cols * lines
+		ret := make([]byte, len(planes))
+		for i := 0; i < pixels; i++ {
+			for b := 0; b < 4; b++ {
+				ret[i*4+b] = planes[b*pixels+i]
+			}
+		}
+		return ret, used, nil
+	}
+
+	p := riceParams{
+		BitsPerSample: bitsPerPixel,
+		BlockSize:     pixelsPerBlock,
+		Flags:         flags,
+	}
+	if pixelsPerBlock > 0 {
+		p.RSI = (cols + pixelsPerBlock - 1) / pixelsPerBlock
+	}
+	if err := p.validate(); err != nil {
+		return nil, 0, err
+	}
+
+	r := &riceBitReader{data: data}
+	padded := p.RSI * p.BlockSize
+	samples, err := p.decodeSamples(r, padded*lines)
+	used := (r.pos + 7) / 8
+	if err != nil {
+		return nil, used, err
+	}
+	if p.Flags&RiceNNOption != 0 {
+		p.postprocess(samples)
+	}
+
+	sampleBytes := riceSampleBytes(bitsPerPixel)
+	msb := p.Flags&RiceMSBOption != 0
+
+	ret := make([]byte, 0, cols*lines*sampleBytes)
+	for line := 0; line < lines; line++ {
+		for _, v := range samples[line*padded : line*padded+cols] {
+			for i := 0; i < sampleBytes; i++ {
+				shift := uint(i * 8)
+				if msb {
+					shift = uint((sampleBytes - 1 - i) * 8)
+				}
+				ret = append(ret, byte(v>>shift))
+			}
+		}
+	}
+	return ret, used, nil
+}
@@ -0,0 +1,291 @@
+package lrit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// Builds Rice streams one codeword at a time, so each test case spells out the coding options it exercises
+type riceBitWriter struct {
+	data []byte
+	pos  int
+}
+
+func (w *riceBitWriter) bits(n int, v uint32) {
+	for i := n - 1; i >= 0; i-- {
+		if w.pos%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+		w.data[w.pos/8] |= byte((v>>uint(i))&1) << (7 - uint(w.pos%8))
+		w.pos++
+	}
+}
+
+func (w *riceBitWriter) fs(n uint32) {
+	for i := uint32(0); i < n; i++ {
+		w.bits(1, 0)
+	}
+	w.bits(1, 1)
+}
+
+// Second extension codeword for a pair of samples
+func riceSECodeword(a, b uint32) uint32 {
+	beta := a + b
+	return beta*(beta+1)/2 + b
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// Chunks written by the HDF5 szip filter, from HDF5's tfilters.h5 and h5repack_szip.h5 test files. Both are 32 bit
+// little endian integers, coded with the K13, NN, LSB and raw options
+func TestRiceDecompressHDF5Chunks(t *testing.T) {
+	tests := []struct {
+		name             string
+		data             string
+		ppb, cols, lines int
+		rowStep          int32
+	}{
+		{
+			name: "tfilters.h5 szip, 4 pixels per block, padded scanlines",
+			data: `200922321449119142488c8f124464a09223264491193c2488ca312446540922
+				32b4491180020008002000800200080020008002000800200080020008002000
+				80020008002000800200080020008002000800200080020008`,
+			ppb: 4, cols: 5, lines: 10, rowStep: 10,
+		},
+		{
+			name: "h5repack_szip.h5 dset_szip, 8 pixels per block",
+			data: `4015558049fd0a2aaa0093fa2855540127f478aaa8024fe9415550049fd322aa
+				a0093fa7855540127f518aaa8024fea815550049fd5a2aaa0093fac855540127
+				f5b8aaa8024febc15550049fd022aaa0093fa1855540127f458aaa8024fe9015
+				550049fd2a2aaa0093fa6855540127f4f8aaa8024fe000800200080020008002
+				000800200080020008002000800a002800a002800a002800a000800200080020
+				0080020008002000800200080020008002000800200080020008002000800200
+				08002000800200080020008002000800200080020008002000800200080020`,
+			ppb: 8, cols: 10, lines: 20, rowStep: 20,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := RiceAllowK13Option | RiceLSBOption | RiceNNOption | RiceRawOption
+			got, _, err := riceDecompress(mustHex(t, tt.data), 32, tt.ppb, tt.cols, tt.lines, flags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := make([]byte, 0, tt.cols*tt.lines*4)
+			for r := 0; r < tt.lines; r++ {
+				for c := 0; c < tt.cols; c++ {
+					want = binary.LittleEndian.AppendUint32(want, uint32(int32(r)*tt.rowStep+int32(c)))
+				}
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestRiceDecompressOptions(t *testing.T) {
+	tests := []struct {
+		name                         string
+		bpp, ppb, cols, lines, flags int
+		stream                       func(w *riceBitWriter)
+		want                         []byte
+	}{
+		{
+			name: "split sample, 8 bpp",
+			bpp:  8, ppb: 8, cols: 8, lines: 1, flags: RiceRawOption,
+			stream: func(w *riceBitWriter) {
+				samples := []uint32{5, 0, 12, 3, 7, 1, 9, 20}
+				w.bits(3, 3) // k = 2
+				for _, s := range samples {
+					w.fs(s >> 2)
+				}
+				for _, s := range samples {
+					w.bits(2, s&3)
+				}
+			},
+			want: []byte{5, 0, 12, 3, 7, 1, 9, 20},
+		},
+		{
+			name: "no compression, 10 bpp, MSB",
+			bpp:  10, ppb: 8, cols: 8, lines: 1, flags: RiceMSBOption | RiceRawOption,
+			stream: func(w *riceBitWriter) {
+				w.bits(4, 15)
+				for _, s := range []uint32{0, 1023, 512, 3, 700, 1, 2, 999} {
+					w.bits(10, s)
+				}
+			},
+			want: []byte{0x00, 0x00, 0x03, 0xff, 0x02, 0x00, 0x00, 0x03, 0x02, 0xbc, 0x00, 0x01, 0x00, 0x02, 0x03, 0xe7},
+		},
+		{
+			name: "zero block to the end of the segment, 12 bpp, NN",
+			bpp:  12, ppb: 8, cols: 32, lines: 1, flags: RiceNNOption | RiceRawOption,
+			stream: func(w *riceBitWriter) {
+				w.bits(4, 0)
+				w.bits(1, 0)
+				w.bits(12, 0x123)
+				w.fs(4) // ROS
+			},
+			want: bytes.Repeat([]byte{0x23, 0x01}, 32),
+		},
+		{
+			name: "zero block run, split and no compression, 8 bpp",
+			bpp:  8, ppb: 8, cols: 64, lines: 1, flags: RiceECOption | RiceRawOption,
+			stream: func(w *riceBitWriter) {
+				w.bits(3, 0)
+				w.bits(1, 0)
+				w.fs(6)      // 6 zero blocks
+				w.bits(3, 1) // k = 0
+				for i := 0; i < 8; i++ {
+					w.fs(1)
+				}
+				w.bits(3, 7)
+				for i := uint32(0); i < 8; i++ {
+					w.bits(8, i)
+				}
+			},
+			want: append(append(make([]byte, 48), bytes.Repeat([]byte{1}, 8)...), 0, 1, 2, 3, 4, 5, 6, 7),
+		},
+		{
+			name: "second extension, 16 bpp, NN, MSB",
+			bpp:  16, ppb: 8, cols: 8, lines: 1, flags: RiceNNOption | RiceMSBOption | RiceRawOption,
+			stream: func(w *riceBitWriter) {
+				w.bits(4, 0)
+				w.bits(1, 1)
+				w.bits(16, 1000)
+				// The reference sample takes the place of the first sample of the first pair
+				w.fs(riceSECodeword(0, 2))
+				w.fs(riceSECodeword(1, 0))
+				w.fs(riceSECodeword(0, 0))
+				w.fs(riceSECodeword(3, 1))
+			},
+			want: []byte{0x03, 0xe8, 0x03, 0xe9, 0x03, 0xe8, 0x03, 0xe8, 0x03, 0xe8, 0x03, 0xe8, 0x03, 0xe6, 0x03, 0xe5},
+		},
+		{
+			name: "two padded scanlines, 10 bpp, NN",
+			bpp:  10, ppb: 4, cols: 6, lines: 2, flags: RiceNNOption | RiceRawOption,
+			stream: func(w *riceBitWriter) {
+				// First scanline: split sample with a reference, then an uncompressed block
+				w.bits(4, 2) // k = 1
+				w.bits(10, 5)
+				for _, d := range []uint32{2, 4, 1} {
+					w.fs(d >> 1)
+				}
+				for _, d := range []uint32{2, 4, 1} {
+					w.bits(1, d&1)
+				}
+				w.bits(4, 15)
+				for _, d := range []uint32{0, 3, 0, 0} {
+					w.bits(10, d)
+				}
+				// Second scanline: a zero block with a reference, then a second extension block
+				w.bits(4, 0)
+				w.bits(1, 0)
+				w.bits(10, 1023)
+				w.fs(0)
+				w.bits(4, 0)
+				w.bits(1, 1)
+				w.fs(riceSECodeword(1, 0))
+				w.fs(riceSECodeword(0, 0))
+			},
+			want: []byte{
+				5, 0, 6, 0, 8, 0, 7, 0, 7, 0, 5, 0,
+				0xff, 0x03, 0xff, 0x03, 0xff, 0x03, 0xff, 0x03, 0xfe, 0x03, 0xfe, 0x03,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &riceBitWriter{}
+			tt.stream(w)
+			got, _, err := riceDecompress(w.data, tt.bpp, tt.ppb, tt.cols, tt.lines, tt.flags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRiceDecompressErrors(t *testing.T) {
+	tests := []struct {
+		name                  string
+		bpp, ppb, cols, flags int
+		stream                func(w *riceBitWriter)
+	}{
+		{
+			name: "split sample out of range",
+			bpp:  8, ppb: 8, cols: 8, flags: RiceRawOption,
+			stream: func(w *riceBitWriter) {
+				w.bits(3, 2) // k = 1
+				w.fs(255)    // 511
+				for i := 0; i < 7; i++ {
+					w.fs(0)
+				}
+				w.bits(8, 0xff)
+			},
+		},
+		{
+			name: "second extension out of range",
+			bpp:  2, ppb: 8, cols: 8, flags: RiceRawOption,
+			stream: func(w *riceBitWriter) {
+				w.bits(3, 0)
+				w.bits(1, 1)
+				w.fs(riceSECodeword(0, 4))
+				for i := 0; i < 3; i++ {
+					w.fs(0)
+				}
+			},
+		},
+		{
+			name: "zero block run past the end of the scanline",
+			bpp:  8, ppb: 8, cols: 16, flags: RiceRawOption,
+			stream: func(w *riceBitWriter) {
+				w.bits(3, 0)
+				w.bits(1, 0)
+				w.fs(2) // 3 zero blocks, but there are only 2
+			},
+		},
+		{
+			name: "truncated",
+			bpp:  8, ppb: 8, cols: 8, flags: RiceRawOption,
+			stream: func(w *riceBitWriter) {
+				w.bits(3, 7)
+				w.bits(8, 1)
+			},
+		},
+		{
+			name: "odd block size",
+			bpp:  8, ppb: 5, cols: 10, flags: RiceRawOption,
+			stream: func(w *riceBitWriter) {
+				w.bits(3, 0)
+				w.bits(1, 0)
+				w.fs(4)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &riceBitWriter{}
+			tt.stream(w)
+			if got, _, err := riceDecompress(w.data, tt.bpp, tt.ppb, tt.cols, 1, tt.flags); err == nil {
+				t.Errorf("expected an error, got %v", got)
+			}
+		})
+	}
+}
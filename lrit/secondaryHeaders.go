@@ -45,7 +45,11 @@ func (h RiceCompressionHeader) HeaderType() SecondaryHeaderType {
 }
 
 func (h DCSFilenameHeader) HeaderType() SecondaryHeaderType {
-	return RiceCompressionHeaderType
+	return DCSFilenameHeaderType
+}
+
+func (h UnknownHeader) HeaderType() SecondaryHeaderType {
+	return SecondaryHeaderType(h.Type)
 }
 
 func (h ImageStructureHeader) HeaderLength() uint16 {
@@ -95,3 +99,7 @@ func (h RiceCompressionHeader) HeaderLength() uint16 {
 func (h DCSFilenameHeader) HeaderLength() uint16 {
 	return h.Length
 }
+
+func (h UnknownHeader) HeaderLength() uint16 {
+	return h.Length
+}
@@ -0,0 +1,93 @@
+package lrit
+
+import (
+	"fmt"
+)
+
+// Decompresses a Rice compressed image one packet at a time. Every packet holds ScanlinesPerPacket rows, so the
+// stream always knows which row the next packet starts on, and how many rows a lost or corrupt packet covered
+type RiceStream struct {
+	ISH ImageStructureHeader
+	RCH RiceCompressionHeader
+	// The next row to be written
+	Row int
+}
+
+func NewRiceStream(ish ImageStructureHeader, rch RiceCompressionHeader) *RiceStream {
+	return &RiceStream{
+		ISH: ish,
+		RCH: rch,
+	}
+}
+
+func (s *RiceStream) LinesPerPacket() int {
+	return max(1, int(s.RCH.ScanlinesPerPacket))
+}
+
+func (s *RiceStream) RemainingRows() int {
+	return max(0, int(s.ISH.NumRows)-s.Row)
+}
+
+// Decompresses the next packet, and returns its rows and how many there were. If the packet can't be decompressed,
+// the stream doesn't move on; use Skip() to account for its rows
+func (s *RiceStream) Decode(packet []byte) ([]byte, int, error) {
+	lines := min(s.LinesPerPacket(), s.RemainingRows())
+	if lines == 0 {
+		return nil, 0, fmt.Errorf("Rice packet is past the last row of the image (%d rows)", s.ISH.NumRows)
+	}
+	if len(packet) == 0 {
+		return nil, 0, fmt.Errorf("Empty Rice packet")
+	}
+
+	d, _, err := s.decode(packet, lines)
+	if err != nil {
+		return nil, 0, err
+	}
+	s.Row += lines
+	return d, lines, nil
+}
+
+// Decompresses every remaining row from packets that follow each other in data, as they do in a file written
+// without decompressing it
+func (s *RiceStream) DecodeAll(data []byte) ([]byte, error) {
+	// The header sizes can't be trusted until the data has been decoded, so don't let them reserve more than the data
+	// could plausibly hold
+	size := s.RemainingRows() * rowBytes(s.ISH)
+	ret := make([]byte, 0, min(size, 4*len(data)))
+	for s.RemainingRows() > 0 {
+		if len(data) == 0 {
+			return ret, fmt.Errorf("Rice data ended at row %d of %d", s.Row, s.ISH.NumRows)
+		}
+		lines := min(s.LinesPerPacket(), s.RemainingRows())
+		d, used, err := s.decode(data, lines)
+		if err != nil {
+			return ret, fmt.Errorf("Row %d: %s", s.Row, err.Error())
+		}
+		ret = append(ret, d...)
+		data = data[used:]
+		s.Row += lines
+	}
+	return ret, nil
+}
+
+// The fewest bytes the remaining rows could be compressed into. Every packet starts on a new byte, and needs at least
+// one bit for every 64 blocks
+func (s *RiceStream) MinLength() int {
+	lines := s.LinesPerPacket()
+	packets := (s.RemainingRows() + lines - 1) / lines
+	blocks := (int(s.ISH.NumCols)*lines + max(1, int(s.RCH.PixelsPerBlock)) - 1) / max(1, int(s.RCH.PixelsPerBlock))
+	return packets * max(1, (blocks+64*8-1)/(64*8))
+}
+
+// NOAA don't set the raw option in their headers, but their images are raw
+func (s *RiceStream) decode(data []byte, lines int) ([]byte, int, error) {
+	return riceDecompress(data, int(s.ISH.BitsPerPixel), int(s.RCH.PixelsPerBlock), int(s.ISH.NumCols), lines, int(s.RCH.Flags)|RiceRawOption)
+}
+
+// Moves the stream past rows that won't be decoded, and returns how many rows that was, capped at the end of the
+// image
+func (s *RiceStream) Skip(rows int) int {
+	rows = min(rows, s.RemainingRows())
+	s.Row += rows
+	return rows
+}
@@ -0,0 +1,92 @@
+package lrit
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/jrwynneiii/ccsds_tools/packets"
+)
+
+// The timestamp header holds a CDS time code with its P-field: 1 byte P-field, 2 bytes of days since 1958 and 4 bytes
+// of milliseconds of the day
+func (h TimestampHeader) Timestamp() (time.Time, error) {
+	raw := make([]byte, 7)
+	for i := range raw {
+		raw[i] = byte(h.Time >> (8 * (6 - i)))
+	}
+	if raw[0] == 0 {
+		// Some files leave the P-field empty, so fall back to the LRIT default format
+		raw[0] = 0x40
+	}
+	return packets.TimeCodeFormat{PField: true}.Decode(raw)
+}
+
+// Returns the time from the file's timestamp header, or the zero time if it doesn't have one
+func (l File) Timestamp() time.Time {
+	if h, ok := l.FindSecondaryHeader(TimestampHeaderType).(TimestampHeader); ok {
+		if t, err := h.Timestamp(); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// GOES-R product names carry their scan start, end and creation times as _s, _e and _c followed by YYYYJJJHHMMSSt,
+// e.g. OR_ABI-L2-CMIPF-M6C13_G16_s20240011200205_e20240011209513_c20240011209591
+var (
+	scanStartRe = regexp.MustCompile(`_s(\d{14})`)
+	scanEndRe   = regexp.MustCompile(`_e(\d{14})`)
+	createdRe   = regexp.MustCompile(`_c(\d{14})`)
+)
+
+// Parses a YYYYJJJHHMMSSt time, as used in GOES-R product names
+func ParseProductTime(s string) (time.Time, error) {
+	if len(s) != 14 {
+		return time.Time{}, fmt.Errorf("Invalid product time %q: want 14 digits", s)
+	}
+	var fields [6]int
+	for i, r := range [][2]int{{0, 4}, {4, 7}, {7, 9}, {9, 11}, {11, 13}, {13, 14}} {
+		v, err := strconv.Atoi(s[r[0]:r[1]])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("Invalid product time %q: %s", s, err.Error())
+		}
+		fields[i] = v
+	}
+	year, doy, hour, minute, second, tenths := fields[0], fields[1], fields[2], fields[3], fields[4], fields[5]
+	if doy < 1 || doy > 366 || hour > 23 || minute > 59 || second > 60 {
+		return time.Time{}, fmt.Errorf("Invalid product time %q", s)
+	}
+	return time.Date(year, time.January, doy, hour, minute, second, tenths*int(100*time.Millisecond), time.UTC), nil
+}
+
+func productTime(re *regexp.Regexp, name string) time.Time {
+	if m := re.FindStringSubmatch(name); m != nil {
+		if t, err := ParseProductTime(m[1]); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Start of the scan the product was made from, from its name. Zero if the name doesn't say
+func (l File) ScanStart() time.Time {
+	return productTime(scanStartRe, l.GetName())
+}
+
+func (l File) ScanEnd() time.Time {
+	return productTime(scanEndRe, l.GetName())
+}
+
+func (l File) CreationTime() time.Time {
+	return productTime(createdRe, l.GetName())
+}
+
+// Best guess at when the product was observed: the scan start if the name has one, otherwise the timestamp header
+func (l File) ObservationTime() time.Time {
+	if t := l.ScanStart(); !t.IsZero() {
+		return t
+	}
+	return l.Timestamp()
+}
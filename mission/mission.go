@@ -0,0 +1,94 @@
+package mission
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+type FrameFormat string
+
+const (
+	// CCSDS AOS (732.0-B) VCDUs carrying M_PDUs, as used by the GOES and GK-2A xRIT downlinks
+	AOSFrameFormat FrameFormat = "aos"
+	// CCSDS TM (132.0-B) transfer frames carrying space packets
+	TMFrameFormat FrameFormat = "tm"
+)
+
+// A Profile bundles everything that changes between downlinks, so that switching satellites is a single config
+// setting
+type Profile struct {
+	Name        string
+	Description string
+
+	// Names for each virtual channel, and the VCID used for idle/fill frames
+	VCIDs    map[int]string
+	IdleVCID int
+
+	// Known spacecraft IDs for this mission
+	Spacecraft map[uint16]string
+	// VCIDs carrying the downlinking satellite's own products, which the satellite can be identified from. Partner
+	// satellite relays must be left out
+	OwnProductVCIDs []int
+
+	// Frame format
+	FrameFormat   FrameFormat
+	FrameSize     int
+	LastFrameSize int
+	NRZM          bool
+	// The encoded sync words the correlator looks for, at 0 and 180 degrees. These depend on NRZM, since the sync word
+	// is differentially encoded along with the rest of the frame. If unset, the GOES-R HRIT words are used
+	SyncWord0Deg   uint64
+	SyncWord180Deg uint64
+	// TM frames only: whether frames carry a frame error control field
+	FECF bool
+	// AOS frames only: whether the header carries a FHEC field, and the length of the insert zone
+	FHEC             bool
+	InsertZoneLength int
+	// Whether space packets end with a CRC-16, as xRIT CP_PDUs do
+	PacketCRC bool
+
+	// Demodulator defaults
+	SymbolRate float64
+	RRCAlpha   float64
+	RRCTaps    int
+	PLLAlpha   float32
+}
+
+var profilesMutex sync.RWMutex
+
+func Register(p Profile) {
+	profilesMutex.Lock()
+	defer profilesMutex.Unlock()
+	Profiles[p.Name] = p
+}
+
+func Lookup(name string) (Profile, error) {
+	profilesMutex.RLock()
+	defer profilesMutex.RUnlock()
+	if name == "" {
+		name = DefaultProfile
+	}
+	if p, ok := Profiles[name]; ok {
+		return p, nil
+	}
+	return Profile{}, fmt.Errorf("Unknown mission profile: %s", name)
+}
+
+func Names() []string {
+	profilesMutex.RLock()
+	defer profilesMutex.RUnlock()
+	var ret []string
+	for name := range Profiles {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func (p Profile) VCIDName(vcid int) string {
+	if name, ok := p.VCIDs[vcid]; ok {
+		return name
+	}
+	return fmt.Sprintf("VCID %d", vcid)
+}
@@ -0,0 +1,52 @@
+package mission
+
+import (
+	"math/bits"
+	"testing"
+)
+
+// The CCSDS attached sync marker at the start of every frame
+const asm uint32 = 0x1acffc1d
+
+// Encodes the sync marker the way the downlink does: NRZ-M if the profile uses it, then the k=7 rate 1/2
+// convolutional code with both outputs inverted. At 180 degrees the bits going into the encoder are inverted
+func encodeASM(nrzm bool, phase180 bool) uint64 {
+	var word uint64
+	var state uint8
+	last := uint32(0)
+	if phase180 && nrzm {
+		last = 1
+	}
+	for i := 31; i >= 0; i-- {
+		bit := (asm >> i) & 1
+		if nrzm {
+			last ^= bit
+			bit = last
+		} else if phase180 {
+			bit ^= 1
+		}
+		state = (state<<1 | uint8(bit)) & 0x7f
+		g1 := uint64(bits.OnesCount8(state&0x4f)&1) ^ 1
+		g2 := uint64(bits.OnesCount8(state&0x6d)&1) ^ 1
+		word = word<<2 | g1<<1 | g2
+	}
+	return word
+}
+
+func TestSyncWordsCorrelate(t *testing.T) {
+	// The first 6 symbol pairs depend on the end of the previous frame, which is still in the encoder
+	const mask = 1<<52 - 1
+	for _, name := range Names() {
+		p, _ := Lookup(name)
+		if p.SyncWord0Deg == 0 || p.SyncWord180Deg == 0 {
+			t.Errorf("%s: no sync words", name)
+			continue
+		}
+		if want := encodeASM(p.NRZM, false); (p.SyncWord0Deg^want)&mask != 0 {
+			t.Errorf("%s: 0 degree sync word is %#016x, want %#016x", name, p.SyncWord0Deg, want)
+		}
+		if want := encodeASM(p.NRZM, true); (p.SyncWord180Deg^want)&mask != 0 {
+			t.Errorf("%s: 180 degree sync word is %#016x, want %#016x", name, p.SyncWord180Deg, want)
+		}
+	}
+}
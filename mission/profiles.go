@@ -0,0 +1,127 @@
+package mission
+
+const DefaultProfile = "goes-r-hrit"
+
+var GOESRHRIT = Profile{
+	Name:        "goes-r-hrit",
+	Description: "GOES-R series (GOES-16/18/19) HRIT",
+	VCIDs: map[int]string{
+		0:  "Admin Text",
+		1:  "Mesoscale",
+		2:  "Visual",
+		6:  "GOES-ABI",
+		7:  "Shortwave IR",
+		8:  "Mid-Level Water Vapor",
+		9:  "Upper-Level Water Vapor",
+		13: "Clean Long-Wave IR",
+		14: "IR Long-Wave",
+		15: "Dirty Long-Wave IR",
+		17: "Partner GOES-R - Clean Long-Wave IR",
+		20: "EMWIN - High Priority",
+		21: "EMWIN - Graphics",
+		22: "EMWIN - Low Priority",
+		23: "GOES-ABI",
+		24: "NHC Maritime Graphics",
+		25: "Misc GOES Graphics",
+		26: "INTL",
+		30: "DCS Admin",
+		31: "DCS",
+		32: "DCS (New Format)",
+		60: "Himawari",
+		63: "IDLE",
+	},
+	IdleVCID:        63,
+	Spacecraft:      map[uint16]string{},
+	OwnProductVCIDs: []int{1, 2, 7, 8, 9, 13, 14, 15},
+	FrameFormat:     AOSFrameFormat,
+	FrameSize:       1024,
+	LastFrameSize:   64,
+	NRZM:            true,
+	SyncWord0Deg:    0xfc4ef4fd0cc2df89,
+	SyncWord180Deg:  0x25010b02f33d2076,
+	PacketCRC:       true,
+	SymbolRate:      927000,
+	RRCAlpha:        0.3,
+	RRCTaps:         31,
+	PLLAlpha:        0.001,
+}
+
+var GOESLRIT = Profile{
+	Name:        "goes-lrit",
+	Description: "Legacy GOES-N/O/P LRIT",
+	VCIDs: map[int]string{
+		63: "IDLE",
+	},
+	IdleVCID:       63,
+	Spacecraft:     map[uint16]string{},
+	FrameFormat:    AOSFrameFormat,
+	FrameSize:      1024,
+	LastFrameSize:  64,
+	NRZM:           false,
+	SyncWord0Deg:   0xfca2b63db00d9794,
+	SyncWord180Deg: 0x035d49c24ff2686b,
+	PacketCRC:      true,
+	SymbolRate:     293883,
+	RRCAlpha:       0.5,
+	RRCTaps:        31,
+	PLLAlpha:       0.001,
+}
+
+var GK2ALRIT = Profile{
+	Name:        "gk2a-lrit",
+	Description: "GEO-KOMPSAT-2A LRIT",
+	VCIDs: map[int]string{
+		0:  "Full Disk",
+		4:  "Alpha-numeric Text",
+		5:  "Additional Data",
+		63: "IDLE",
+	},
+	IdleVCID: 63,
+	Spacecraft: map[uint16]string{
+		195: "GK-2A",
+	},
+	FrameFormat:    AOSFrameFormat,
+	FrameSize:      1024,
+	LastFrameSize:  64,
+	NRZM:           true,
+	SyncWord0Deg:   0xfc4ef4fd0cc2df89,
+	SyncWord180Deg: 0x25010b02f33d2076,
+	PacketCRC:      true,
+	SymbolRate:     128000,
+	RRCAlpha:       0.5,
+	RRCTaps:        31,
+	PLLAlpha:       0.001,
+}
+
+var GK2AHRIT = Profile{
+	Name:        "gk2a-hrit",
+	Description: "GEO-KOMPSAT-2A HRIT",
+	VCIDs: map[int]string{
+		0:  "Full Disk",
+		4:  "Alpha-numeric Text",
+		5:  "Additional Data",
+		63: "IDLE",
+	},
+	IdleVCID: 63,
+	Spacecraft: map[uint16]string{
+		195: "GK-2A",
+	},
+	FrameFormat:    AOSFrameFormat,
+	FrameSize:      1024,
+	LastFrameSize:  64,
+	NRZM:           true,
+	SyncWord0Deg:   0xfc4ef4fd0cc2df89,
+	SyncWord180Deg: 0x25010b02f33d2076,
+	PacketCRC:      true,
+	SymbolRate:     3000000,
+	RRCAlpha:       0.5,
+	RRCTaps:        31,
+	PLLAlpha:       0.001,
+}
+
+var Profiles = map[string]Profile{
+	GOESRHRIT.Name: GOESRHRIT,
+	GOESLRIT.Name:  GOESLRIT,
+	GK2ALRIT.Name:  GK2ALRIT,
+	GK2AHRIT.Name:  GK2AHRIT,
+}
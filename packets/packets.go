@@ -2,13 +2,14 @@ package packets
 
 import (
 	"fmt"
+	"time"
 )
 
 // Size = 892 bytes
 type VCDU struct {
 	// VCDU Header 6 bytes
 	VCDUVersion uint8
-	VCDUSCID    uint8
+	VCDUSCID    uint16
 	VCID        uint8
 	VCDUCounter uint32
 	VCDUReplay  bool
@@ -16,12 +17,21 @@ type VCDU struct {
 	// M_PDU Header 2 bytes
 	FirstHeaderOffset uint16
 
+	// Only set for TM frames
+	MasterChannelCounter uint8
+	SecondaryHeader      []byte
+	OCF                  []byte
+	Idle                 bool
+
 	MSDUs []MSDU
 
 	Data []byte
 
 	//Custom non-ccsds parameters
 	IsCorrupt bool
+	Quality   FrameQuality
+	// Nibbles of the AOS header fixed by the FHEC, if it is in use
+	HeaderCorrections int
 }
 
 type TransportFileHeader struct {
@@ -60,11 +70,17 @@ type MSDU struct {
 	Data []byte
 
 	VCDUVersion uint8
-	VCDUSCID    uint8
+	VCDUSCID    uint16
 	VCID        uint8
 	VCDUCounter uint32
 	VCDUReplay  bool
-	CRCGood     bool
+	// Always true if the frame format's packets don't carry a CRC
+	CRCGood bool
+
+	// Link quality of every VCDU this SDU was carried in
+	Quality QualitySummary
+	// Decoded from the secondary header, for APIDs configured to carry a time code. Zero otherwise
+	Time time.Time
 }
 
 // Derived from GOESTools
@@ -99,6 +115,16 @@ func CounterDiff(div, a, b uint32) uint {
 	return ret
 }
 
+// Virtual channel ID of an AOS frame
+func AOSVCID(data []byte) uint8 {
+	return data[1] & 0x3f
+}
+
+// Virtual channel ID of a TM frame
+func TMVCID(data []byte) uint8 {
+	return (data[1] & 0x0e) >> 1
+}
+
 func FrameIsValid(data []byte) bool {
 	if len(data) != 892 {
 		return false
@@ -136,6 +162,13 @@ func (v *VCDU) IsFillPacket() bool {
 	return false
 }
 
+// Returns a copy of a replayed VCDU with the replay flag cleared, for feeding to a separate replay assembler
+func (v *VCDU) AsRealtime() *VCDU {
+	c := *v
+	c.VCDUReplay = false
+	return &c
+}
+
 func (v *VCDU) String() string {
 	return fmt.Sprintf("%##v", *v)
 }
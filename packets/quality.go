@@ -0,0 +1,111 @@
+package packets
+
+import (
+	"time"
+)
+
+// Link quality information for a single frame, as measured by the datalink layer
+type FrameQuality struct {
+	ReceivedAt       time.Time
+	ViterbiBER       int
+	RSCorrections    []int // Per RS codeword; -1 means the codeword could not be corrected
+	CorrelationScore uint
+	FrameLock        bool // True if the frame was found where we expected it, without recorrelating
+}
+
+// A decoded frame as output by the datalink layer
+type Frame struct {
+	Data    []byte
+	Quality FrameQuality
+}
+
+// Aggregated link quality for everything that went into an SDU or a file
+type QualitySummary struct {
+	Frames                 int
+	FirstReceived          time.Time
+	LastReceived           time.Time
+	MaxViterbiBER          int
+	TotalViterbiBER        int
+	TotalRSCorrections     int
+	MaxRSCorrections       int
+	UncorrectableCodewords int
+	MinCorrelationScore    uint
+	UnlockedFrames         int
+}
+
+func (q FrameQuality) TotalRSCorrections() int {
+	total := 0
+	for _, c := range q.RSCorrections {
+		if c > 0 {
+			total += c
+		}
+	}
+	return total
+}
+
+func (s *QualitySummary) Add(q FrameQuality) {
+	if s.Frames == 0 || q.ReceivedAt.Before(s.FirstReceived) {
+		s.FirstReceived = q.ReceivedAt
+	}
+	if q.ReceivedAt.After(s.LastReceived) {
+		s.LastReceived = q.ReceivedAt
+	}
+	if s.Frames == 0 || q.CorrelationScore < s.MinCorrelationScore {
+		s.MinCorrelationScore = q.CorrelationScore
+	}
+	s.Frames++
+
+	s.TotalViterbiBER += q.ViterbiBER
+	s.MaxViterbiBER = max(s.MaxViterbiBER, q.ViterbiBER)
+
+	rs := q.TotalRSCorrections()
+	s.TotalRSCorrections += rs
+	s.MaxRSCorrections = max(s.MaxRSCorrections, rs)
+	for _, c := range q.RSCorrections {
+		if c < 0 {
+			s.UncorrectableCodewords++
+		}
+	}
+
+	if !q.FrameLock {
+		s.UnlockedFrames++
+	}
+}
+
+func (s *QualitySummary) Merge(o QualitySummary) {
+	if o.Frames == 0 {
+		return
+	}
+	if s.Frames == 0 {
+		*s = o
+		return
+	}
+	if o.FirstReceived.Before(s.FirstReceived) {
+		s.FirstReceived = o.FirstReceived
+	}
+	if o.LastReceived.After(s.LastReceived) {
+		s.LastReceived = o.LastReceived
+	}
+	s.MinCorrelationScore = min(s.MinCorrelationScore, o.MinCorrelationScore)
+	s.Frames += o.Frames
+	s.TotalViterbiBER += o.TotalViterbiBER
+	s.MaxViterbiBER = max(s.MaxViterbiBER, o.MaxViterbiBER)
+	s.TotalRSCorrections += o.TotalRSCorrections
+	s.MaxRSCorrections = max(s.MaxRSCorrections, o.MaxRSCorrections)
+	s.UncorrectableCodewords += o.UncorrectableCodewords
+	s.UnlockedFrames += o.UnlockedFrames
+}
+
+func (s QualitySummary) AvgViterbiBER() float64 {
+	if s.Frames == 0 {
+		return 0
+	}
+	return float64(s.TotalViterbiBER) / float64(s.Frames)
+}
+
+func (s QualitySummary) AvgRSCorrections() float64 {
+	if s.Frames == 0 {
+		return 0
+	}
+	return float64(s.TotalRSCorrections) / float64(s.Frames)
+}
@@ -0,0 +1,92 @@
+package packets
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// Known spacecraft, keyed by the AOS (8 bit) or TM (10 bit) spacecraft ID.
+//
+// NOAA does not list the GOES-R series SCIDs in the HRIT/EMWIN spec, so they aren't hardcoded here. They can be
+// added with the `spacecraft` config map, or RegisterSpacecraft(), and are learned from product filenames that
+// identify the satellite (see LearnSpacecraft())
+var Spacecrafts = map[uint16]string{
+	195: "GK-2A",
+}
+
+// How many files in a row have to name the same satellite before LearnSpacecraft() registers it
+var SpacecraftVotesNeeded = 5
+
+var (
+	spacecraftMutex sync.RWMutex
+	ownProductVCIDs map[uint8]bool
+	spacecraftVotes = map[uint16]spacecraftVote{}
+)
+
+type spacecraftVote struct {
+	name  string
+	count int
+}
+
+// Product names from the GOES-R ground segment carry the satellite, e.g. OR_ABI-L2-CMIPF-M6C13_G16_s2024...
+var goesProductNameRe = regexp.MustCompile(`_G(1[6-9])_`)
+
+func RegisterSpacecraft(scid uint16, name string) {
+	spacecraftMutex.Lock()
+	defer spacecraftMutex.Unlock()
+	Spacecrafts[scid] = name
+}
+
+// Limits LearnSpacecraft() to the VCIDs carrying the downlinking satellite's own products. Product names on the
+// others, like partner satellite imagery relayed over GOES-R HRIT, describe a different satellite. With none set, any
+// VCID is used
+func SetOwnProductVCIDs(vcids []int) {
+	spacecraftMutex.Lock()
+	defer spacecraftMutex.Unlock()
+	ownProductVCIDs = make(map[uint8]bool)
+	for _, vcid := range vcids {
+		ownProductVCIDs[uint8(vcid)] = true
+	}
+}
+
+// Counts a product on the given SCID and VCID as coming from the named satellite, and registers the SCID once
+// SpacecraftVotesNeeded files in a row have agreed. An SCID that's already known is never changed. Returns true if
+// the SCID was registered by this call
+func LearnSpacecraft(scid uint16, vcid uint8, name string) bool {
+	spacecraftMutex.Lock()
+	defer spacecraftMutex.Unlock()
+	if _, ok := Spacecrafts[scid]; ok || name == "" {
+		return false
+	}
+	if len(ownProductVCIDs) > 0 && !ownProductVCIDs[vcid] {
+		return false
+	}
+
+	vote := spacecraftVotes[scid]
+	if vote.name != name {
+		vote = spacecraftVote{name: name}
+	}
+	vote.count++
+	if vote.count < SpacecraftVotesNeeded {
+		spacecraftVotes[scid] = vote
+		return false
+	}
+	delete(spacecraftVotes, scid)
+	Spacecrafts[scid] = name
+	return true
+}
+
+func SpacecraftName(scid uint16) (string, bool) {
+	spacecraftMutex.RLock()
+	defer spacecraftMutex.RUnlock()
+	name, ok := Spacecrafts[scid]
+	return name, ok
+}
+
+func SatelliteFromProductName(name string) string {
+	if m := goesProductNameRe.FindStringSubmatch(name); m != nil {
+		return fmt.Sprintf("GOES-%s", m[1])
+	}
+	return ""
+}
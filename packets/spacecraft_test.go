@@ -0,0 +1,48 @@
+package packets
+
+import "testing"
+
+func TestLearnSpacecraft(t *testing.T) {
+	defer func(known map[uint16]string) {
+		Spacecrafts = known
+		ownProductVCIDs = nil
+		spacecraftVotes = map[uint16]spacecraftVote{}
+	}(Spacecrafts)
+	Spacecrafts = map[uint16]string{195: "GK-2A"}
+	SetOwnProductVCIDs([]int{2, 13})
+
+	learn := func(scid uint16, vcid uint8, name string, times int) bool {
+		learned := false
+		for i := 0; i < times; i++ {
+			learned = LearnSpacecraft(scid, vcid, name)
+		}
+		return learned
+	}
+
+	// Partner satellite products relayed on another VCID never count
+	if learn(10, 17, "GOES-16", SpacecraftVotesNeeded*2) {
+		t.Error("learned a satellite from a partner VCID")
+	}
+	// One file short, then a disagreeing file starts the count again
+	learn(10, 13, "GOES-18", SpacecraftVotesNeeded-1)
+	if learn(10, 2, "GOES-16", 1) {
+		t.Error("learned a satellite from a single file")
+	}
+	if _, ok := SpacecraftName(10); ok {
+		t.Error("SCID registered before enough files agreed")
+	}
+	if !learn(10, 13, "GOES-18", SpacecraftVotesNeeded) {
+		t.Error("didn't learn a satellite after enough files agreed")
+	}
+	if name, _ := SpacecraftName(10); name != "GOES-18" {
+		t.Errorf("SCID 10 is %q, want GOES-18", name)
+	}
+
+	// Known SCIDs are never relabelled
+	if learn(10, 13, "GOES-19", SpacecraftVotesNeeded) || learn(195, 13, "GOES-16", SpacecraftVotesNeeded) {
+		t.Error("relabelled a known SCID")
+	}
+	if name, _ := SpacecraftName(195); name != "GK-2A" {
+		t.Errorf("SCID 195 is %q, want GK-2A", name)
+	}
+}
@@ -0,0 +1,307 @@
+package packets
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CCSDS time code formats (CCSDS 301.0-B)
+type TimeCode int
+
+const (
+	// Unsegmented time code: a binary count of seconds and fractions of a second since the epoch
+	CUC TimeCode = iota
+	// Day segmented time code: days since the epoch, milliseconds of the day, and optionally micro/picoseconds
+	CDS
+	// Calendar segmented time code: BCD year, month/day or day of year, hour, minute, second and fractions
+	CCS
+)
+
+// Level 1 time codes count from 1958-01-01 TAI
+var CCSDSEpoch = time.Date(1958, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Describes where a packet's time code is and how to read it. If PField is set, the format is read from the P-field
+// in front of the time code and the implicit format fields are ignored
+type TimeCodeFormat struct {
+	Code   TimeCode
+	PField bool
+
+	// Byte offset of the time code from the start of the packet data (i.e. the start of the secondary header)
+	Offset int
+	// Epoch for CUC/CDS codes. Defaults to the CCSDS epoch
+	Epoch time.Time
+	// Seconds to subtract to get from the spacecraft's time scale to UTC, e.g. 37 for TAI as of 2017
+	LeapSeconds int
+
+	// CUC
+	CoarseOctets int
+	FineOctets   int
+	// CDS: 2 or 3 day octets, and 0, 2 (microseconds) or 4 (picoseconds) submillisecond octets
+	DayOctets         int
+	SubmillisecOctets int
+	// CCS: 0 to 6 octets of BCD hundredths, ten thousandths, etc. of a second
+	SubsecondOctets int
+	DayOfYear       bool
+}
+
+// Parses a time code format from config. Accepted forms are:
+//
+//	pfield              the time code is preceded by its P-field
+//	cuc:<coarse>,<fine> e.g. cuc:4,2
+//	cds:<days>,<submillisecond> e.g. cds:2,0
+//	ccs:<subsecond>[,doy] e.g. ccs:2
+func ParseTimeCodeFormat(s string) (TimeCodeFormat, error) {
+	f := TimeCodeFormat{}
+	name, args, _ := strings.Cut(strings.ToLower(strings.TrimSpace(s)), ":")
+
+	var n []int
+	for _, a := range strings.Split(args, ",") {
+		if a == "doy" {
+			f.DayOfYear = true
+			continue
+		} else if a == "" {
+			continue
+		}
+		i, err := strconv.Atoi(a)
+		if err != nil {
+			return f, fmt.Errorf("Invalid time code format %q: %s", s, err.Error())
+		}
+		n = append(n, i)
+	}
+	arg := func(i, def int) int {
+		if i < len(n) {
+			return n[i]
+		}
+		return def
+	}
+
+	switch name {
+	case "pfield":
+		f.PField = true
+	case "cuc":
+		f.Code = CUC
+		f.CoarseOctets = arg(0, 4)
+		f.FineOctets = arg(1, 0)
+	case "cds":
+		f.Code = CDS
+		f.DayOctets = arg(0, 2)
+		f.SubmillisecOctets = arg(1, 0)
+	case "ccs":
+		f.Code = CCS
+		f.SubsecondOctets = arg(0, 0)
+	default:
+		return f, fmt.Errorf("Unknown time code format: %s", s)
+	}
+	return f, f.validate()
+}
+
+func (f *TimeCodeFormat) validate() error {
+	if f.PField {
+		return nil
+	}
+	switch f.Code {
+	case CUC:
+		if f.CoarseOctets < 1 || f.CoarseOctets > 7 || f.FineOctets < 0 || f.FineOctets > 10 {
+			return fmt.Errorf("Invalid CUC format: %d coarse and %d fine octets", f.CoarseOctets, f.FineOctets)
+		}
+	case CDS:
+		if (f.DayOctets != 2 && f.DayOctets != 3) || (f.SubmillisecOctets != 0 && f.SubmillisecOctets != 2 && f.SubmillisecOctets != 4) {
+			return fmt.Errorf("Invalid CDS format: %d day and %d submillisecond octets", f.DayOctets, f.SubmillisecOctets)
+		}
+	case CCS:
+		if f.SubsecondOctets < 0 || f.SubsecondOctets > 6 {
+			return fmt.Errorf("Invalid CCS format: %d subsecond octets", f.SubsecondOctets)
+		}
+	}
+	return nil
+}
+
+// Decodes the time code out of a packet's data
+func (f TimeCodeFormat) Decode(data []byte) (time.Time, error) {
+	if f.Offset > len(data) {
+		return time.Time{}, fmt.Errorf("Time code offset %d is past the end of the packet", f.Offset)
+	}
+	data = data[f.Offset:]
+
+	var err error
+	if f.PField {
+		if f, data, err = parsePField(f, data); err != nil {
+			return time.Time{}, err
+		}
+	} else if err = f.validate(); err != nil {
+		return time.Time{}, err
+	}
+
+	var t time.Time
+	switch f.Code {
+	case CUC:
+		t, err = f.decodeCUC(data)
+	case CDS:
+		t, err = f.decodeCDS(data)
+	case CCS:
+		// Calendar codes are already UTC
+		return f.decodeCCS(data)
+	}
+	if err != nil {
+		return t, err
+	}
+	return t.Add(-time.Duration(f.LeapSeconds) * time.Second), nil
+}
+
+// Reads the P-field at the start of data into the format, and returns what's left
+func parsePField(f TimeCodeFormat, data []byte) (TimeCodeFormat, []byte, error) {
+	if len(data) < 1 {
+		return f, data, fmt.Errorf("Packet too short for a time code P-field")
+	}
+	p := data[0]
+	data = data[1:]
+	extended := p&0x80 > 0
+	id := (p >> 4) & 0x7
+
+	switch id {
+	case 0b001, 0b010:
+		f.Code = CUC
+		if id == 0b001 {
+			f.Epoch = CCSDSEpoch
+		}
+		f.CoarseOctets = int((p>>2)&0x3) + 1
+		f.FineOctets = int(p & 0x3)
+		if extended {
+			if len(data) < 1 {
+				return f, data, fmt.Errorf("Packet too short for an extended CUC P-field")
+			}
+			f.CoarseOctets += int((data[0] >> 5) & 0x3)
+			f.FineOctets += int((data[0] >> 2) & 0x7)
+			data = data[1:]
+		}
+	case 0b100:
+		f.Code = CDS
+		if p&0x8 == 0 {
+			f.Epoch = CCSDSEpoch
+		}
+		f.DayOctets = 2
+		if p&0x4 > 0 {
+			f.DayOctets = 3
+		}
+		switch p & 0x3 {
+		case 0b00:
+			f.SubmillisecOctets = 0
+		case 0b01:
+			f.SubmillisecOctets = 2
+		case 0b10:
+			f.SubmillisecOctets = 4
+		default:
+			return f, data, fmt.Errorf("Invalid CDS submillisecond resolution in P-field: %#02x", p)
+		}
+	case 0b101:
+		f.Code = CCS
+		f.DayOfYear = p&0x8 > 0
+		f.SubsecondOctets = int(p & 0x7)
+	default:
+		return f, data, fmt.Errorf("Unknown time code ID in P-field: %#02x", p)
+	}
+	f.PField = false
+	return f, data, f.validate()
+}
+
+func (f TimeCodeFormat) epoch() time.Time {
+	if f.Epoch.IsZero() {
+		return CCSDSEpoch
+	}
+	return f.Epoch
+}
+
+func (f TimeCodeFormat) decodeCUC(data []byte) (time.Time, error) {
+	if len(data) < f.CoarseOctets+f.FineOctets {
+		return time.Time{}, fmt.Errorf("Packet too short for a CUC time code: have %d bytes, want %d", len(data), f.CoarseOctets+f.FineOctets)
+	}
+
+	var seconds uint64
+	for _, b := range data[:f.CoarseOctets] {
+		seconds = seconds<<8 | uint64(b)
+	}
+
+	// Only the first 4 fine octets are finer than a nanosecond anyway
+	var fine float64
+	scale := 1.0
+	for _, b := range data[f.CoarseOctets : f.CoarseOctets+f.FineOctets] {
+		scale /= 256
+		fine += float64(b) * scale
+	}
+
+	return f.epoch().Add(time.Duration(seconds) * time.Second).Add(time.Duration(fine * float64(time.Second))), nil
+}
+
+func (f TimeCodeFormat) decodeCDS(data []byte) (time.Time, error) {
+	length := f.DayOctets + 4 + f.SubmillisecOctets
+	if len(data) < length {
+		return time.Time{}, fmt.Errorf("Packet too short for a CDS time code: have %d bytes, want %d", len(data), length)
+	}
+
+	var days uint32
+	for _, b := range data[:f.DayOctets] {
+		days = days<<8 | uint32(b)
+	}
+	data = data[f.DayOctets:]
+	ms := uint32(data[0])<<24 | uint32(data[1])<<16 | uint32(data[2])<<8 | uint32(data[3])
+	data = data[4:]
+
+	t := f.epoch().AddDate(0, 0, int(days)).Add(time.Duration(ms) * time.Millisecond)
+	switch f.SubmillisecOctets {
+	case 2:
+		us := uint16(data[0])<<8 | uint16(data[1])
+		t = t.Add(time.Duration(us) * time.Microsecond)
+	case 4:
+		ps := uint32(data[0])<<24 | uint32(data[1])<<16 | uint32(data[2])<<8 | uint32(data[3])
+		t = t.Add(time.Duration(ps/1000) * time.Nanosecond)
+	}
+	return t, nil
+}
+
+func bcd(b byte) (int, error) {
+	hi, lo := int(b>>4), int(b&0xf)
+	if hi > 9 || lo > 9 {
+		return 0, fmt.Errorf("Invalid BCD digit in time code: %#02x", b)
+	}
+	return hi*10 + lo, nil
+}
+
+func (f TimeCodeFormat) decodeCCS(data []byte) (time.Time, error) {
+	length := 7 + f.SubsecondOctets
+	if len(data) < length {
+		return time.Time{}, fmt.Errorf("Packet too short for a CCS time code: have %d bytes, want %d", len(data), length)
+	}
+
+	var fields []int
+	for _, b := range data[:length] {
+		v, err := bcd(b)
+		if err != nil {
+			return time.Time{}, err
+		}
+		fields = append(fields, v)
+	}
+
+	year := fields[0]*100 + fields[1]
+	hour, minute, second := fields[4], fields[5], fields[6]
+	var nsec int
+	scale := int(time.Second)
+	for _, v := range fields[7:] {
+		scale /= 100
+		nsec += v * scale
+	}
+
+	if f.DayOfYear {
+		doy := fields[2]*100 + fields[3]
+		if doy < 1 || doy > 366 {
+			return time.Time{}, fmt.Errorf("Invalid day of year in CCS time code: %d", doy)
+		}
+		return time.Date(year, time.January, doy, hour, minute, second, nsec, time.UTC), nil
+	}
+	month, day := fields[2], fields[3]
+	if month < 1 || month > 12 || day < 1 || day > 31 {
+		return time.Time{}, fmt.Errorf("Invalid date in CCS time code: %d-%d", month, day)
+	}
+	return time.Date(year, time.Month(month), day, hour, minute, second, nsec, time.UTC), nil
+}
@@ -0,0 +1,136 @@
+package packets
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeCodeDecode(t *testing.T) {
+	agency := time.Date(2000, time.January, 1, 12, 0, 0, 0, time.UTC)
+	// 2020-01-01 is day 22645 (0x5875) of the CCSDS epoch, and 12:34:56.789 is 45296789 (0x02b32c95) ms of the day
+	day := time.Date(2020, time.January, 1, 12, 34, 56, 789000000, time.UTC)
+	// Day 65536 doesn't fit in 2 octets
+	farDay := time.Date(2137, time.June, 7, 12, 34, 56, 789000000, time.UTC)
+
+	tests := []struct {
+		name   string
+		format TimeCodeFormat
+		data   []byte
+		want   time.Time
+	}{
+		{
+			name:   "CUC 4+2",
+			format: TimeCodeFormat{Code: CUC, CoarseOctets: 4, FineOctets: 2},
+			data:   []byte{0x00, 0x00, 0x0e, 0x10, 0x80, 0x00},
+			want:   time.Date(1958, time.January, 1, 1, 0, 0, 500000000, time.UTC),
+		},
+		{
+			name:   "CUC at an offset with leap seconds",
+			format: TimeCodeFormat{Code: CUC, CoarseOctets: 4, Offset: 2, LeapSeconds: 37},
+			data:   []byte{0xff, 0xff, 0x00, 0x00, 0x0e, 0x10},
+			want:   time.Date(1958, time.January, 1, 0, 59, 23, 0, time.UTC),
+		},
+		{
+			name:   "CUC P-field",
+			format: TimeCodeFormat{PField: true},
+			data:   []byte{0x1e, 0x00, 0x00, 0x0e, 0x10, 0x80, 0x00},
+			want:   time.Date(1958, time.January, 1, 1, 0, 0, 500000000, time.UTC),
+		},
+		{
+			name:   "CUC P-field with extension octet",
+			format: TimeCodeFormat{PField: true},
+			// 4+2 octets, extended by 1 coarse and 2 fine octets
+			data: []byte{0x9e, 0x28, 0x00, 0x00, 0x00, 0x0e, 0x10, 0x40, 0x00, 0x00, 0x00},
+			want: time.Date(1958, time.January, 1, 1, 0, 0, 250000000, time.UTC),
+		},
+		{
+			name:   "CUC P-field with agency epoch",
+			format: TimeCodeFormat{PField: true, Epoch: agency},
+			data:   []byte{0x2c, 0x00, 0x01, 0x51, 0x80},
+			want:   time.Date(2000, time.January, 2, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "CDS 2+0",
+			format: TimeCodeFormat{Code: CDS, DayOctets: 2},
+			data:   []byte{0x58, 0x75, 0x02, 0xb3, 0x2c, 0x95},
+			want:   day,
+		},
+		{
+			name:   "CDS P-field",
+			format: TimeCodeFormat{PField: true},
+			data:   []byte{0x40, 0x58, 0x75, 0x02, 0xb3, 0x2c, 0x95},
+			want:   day,
+		},
+		{
+			name:   "CDS P-field with agency epoch",
+			format: TimeCodeFormat{PField: true, Epoch: agency},
+			data:   []byte{0x48, 0x00, 0x01, 0x00, 0x00, 0x03, 0xe8},
+			want:   time.Date(2000, time.January, 2, 12, 0, 1, 0, time.UTC),
+		},
+		{
+			name:   "CDS 24-bit day with microseconds",
+			format: TimeCodeFormat{PField: true},
+			data:   []byte{0x45, 0x01, 0x00, 0x00, 0x02, 0xb3, 0x2c, 0x95, 0x01, 0xf4},
+			want:   farDay.Add(500 * time.Microsecond),
+		},
+		{
+			name:   "CDS 24-bit day with picoseconds",
+			format: TimeCodeFormat{Code: CDS, DayOctets: 3, SubmillisecOctets: 4},
+			// 123456789 ps, truncated to the nanosecond
+			data: []byte{0x01, 0x00, 0x00, 0x02, 0xb3, 0x2c, 0x95, 0x07, 0x5b, 0xcd, 0x15},
+			want: farDay.Add(123456 * time.Nanosecond),
+		},
+		{
+			name:   "CDS P-field with picoseconds",
+			format: TimeCodeFormat{PField: true},
+			data:   []byte{0x42, 0x58, 0x75, 0x02, 0xb3, 0x2c, 0x95, 0x00, 0x00, 0x03, 0xe8},
+			want:   day.Add(time.Nanosecond),
+		},
+		{
+			name:   "CCS month and day",
+			format: TimeCodeFormat{Code: CCS, SubsecondOctets: 2},
+			data:   []byte{0x20, 0x24, 0x02, 0x29, 0x13, 0x45, 0x30, 0x12, 0x34},
+			want:   time.Date(2024, time.February, 29, 13, 45, 30, 123400000, time.UTC),
+		},
+		{
+			name:   "CCS P-field day of year ignores leap seconds",
+			format: TimeCodeFormat{PField: true, LeapSeconds: 37},
+			data:   []byte{0x58, 0x20, 0x24, 0x00, 0x60, 0x13, 0x45, 0x30},
+			want:   time.Date(2024, time.February, 29, 13, 45, 30, 0, time.UTC),
+		},
+	}
+
+	for _, test := range tests {
+		got, err := test.format.Decode(test.data)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err.Error())
+		} else if !got.Equal(test.want) {
+			t.Errorf("%s: got %s, want %s", test.name, got.Format(time.RFC3339Nano), test.want.Format(time.RFC3339Nano))
+		}
+	}
+}
+
+func TestTimeCodeDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		format TimeCodeFormat
+		data   []byte
+	}{
+		{"offset past the end", TimeCodeFormat{Code: CUC, CoarseOctets: 4, Offset: 3}, []byte{0x00, 0x00}},
+		{"short CUC", TimeCodeFormat{Code: CUC, CoarseOctets: 4, FineOctets: 2}, []byte{0x00, 0x00, 0x0e, 0x10}},
+		{"invalid CUC format", TimeCodeFormat{Code: CUC}, []byte{0x00, 0x00, 0x00, 0x00}},
+		{"missing P-field", TimeCodeFormat{PField: true}, []byte{}},
+		{"missing extension octet", TimeCodeFormat{PField: true}, []byte{0x9e}},
+		{"unknown P-field ID", TimeCodeFormat{PField: true}, []byte{0x70, 0x00, 0x00, 0x00, 0x00}},
+		{"reserved CDS resolution", TimeCodeFormat{PField: true}, []byte{0x43, 0x58, 0x75, 0x02, 0xb3, 0x2c, 0x95}},
+		{"short CDS", TimeCodeFormat{Code: CDS, DayOctets: 3}, []byte{0x58, 0x75, 0x02, 0xb3, 0x2c, 0x95}},
+		{"invalid BCD", TimeCodeFormat{Code: CCS}, []byte{0x20, 0x24, 0x02, 0x2a, 0x13, 0x45, 0x30}},
+		{"invalid day of year", TimeCodeFormat{Code: CCS, DayOfYear: true}, []byte{0x20, 0x24, 0x03, 0x67, 0x13, 0x45, 0x30}},
+	}
+
+	for _, test := range tests {
+		if got, err := test.format.Decode(test.data); err == nil {
+			t.Errorf("%s: decoded %s, want an error", test.name, got.Format(time.RFC3339Nano))
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package pipeline
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/jrwynneiii/ccsds_tools/layers/transport"
+	"github.com/jrwynneiii/ccsds_tools/lrit"
+	"github.com/jrwynneiii/ccsds_tools/packets"
+)
+
+// Helpers for settings that have a sensible default (usually from the mission profile), and so may be left out of
+// the config file or options map entirely
+
+func (p *Pipeline) stringOption(key string, def string) string {
+	if p.configFile != nil {
+		if p.configFile.Exists(key) {
+			return p.configFile.String(key)
+		}
+	} else if v, ok := p.options[key].(string); ok {
+		return v
+	}
+	return def
+}
+
+func (p *Pipeline) intOption(key string, def int) int {
+	if p.configFile != nil {
+		if p.configFile.Exists(key) {
+			return p.configFile.Int(key)
+		}
+	} else if v, ok := p.options[key].(int); ok {
+		return v
+	}
+	return def
+}
+
+// Values too big for a TOML integer, like sync words, can be given as strings, e.g. "0xfca2b63db00d9794"
+func (p *Pipeline) uint64Option(key string, def uint64) uint64 {
+	var s string
+	if p.configFile != nil {
+		if !p.configFile.Exists(key) {
+			return def
+		}
+		s = p.configFile.String(key)
+	} else if v, ok := p.options[key].(uint64); ok {
+		return v
+	} else if s, ok = p.options[key].(string); !ok {
+		return def
+	}
+
+	v, err := strconv.ParseUint(s, 0, 64)
+	if err != nil {
+		log.Errorf("Invalid value for %s: %s", key, s)
+		return def
+	}
+	return v
+}
+
+func (p *Pipeline) float64Option(key string, def float64) float64 {
+	if p.configFile != nil {
+		if p.configFile.Exists(key) {
+			return p.configFile.Float64(key)
+		}
+	} else if v, ok := p.options[key].(float64); ok {
+		return v
+	}
+	return def
+}
+
+func (p *Pipeline) durationOption(key string, def time.Duration) time.Duration {
+	if p.configFile != nil {
+		if p.configFile.Exists(key) {
+			return p.configFile.Duration(key)
+		}
+	} else if v, ok := p.options[key].(time.Duration); ok {
+		return v
+	}
+	return def
+}
+
+func (p *Pipeline) boolOption(key string, def bool) bool {
+	if p.configFile != nil {
+		if p.configFile.Exists(key) {
+			return p.configFile.Bool(key)
+		}
+	} else if v, ok := p.options[key].(bool); ok {
+		return v
+	}
+	return def
+}
+
+func (p *Pipeline) intsOption(key string) []int {
+	if p.configFile != nil {
+		return p.configFile.Ints(key)
+	} else if v, ok := p.options[key].([]int); ok {
+		return v
+	}
+	return []int{}
+}
+
+func (p *Pipeline) stringMapOption(key string) map[string]string {
+	if p.configFile != nil {
+		return p.configFile.StringMap(key)
+	} else if v, ok := p.options[key].(map[string]string); ok {
+		return v
+	}
+	return map[string]string{}
+}
+
+// Reads the transport layer's reassembly policy, which can be set for all VCIDs with transport.fill and
+// transport.continue_on_crc_failure, or per VCID under transport.vcid.<vcid>
+func (p *Pipeline) loadAssemblyPolicies(layer *transport.TransportLayer) {
+	if fill := p.stringOption("transport.fill", ""); fill != "" {
+		if policy, err := lrit.ParseFillPolicy(fill); err == nil {
+			layer.Fill = policy
+		} else {
+			log.Error(err)
+		}
+	}
+
+	for vcid := 0; vcid < 64; vcid++ {
+		prefix := fmt.Sprintf("transport.vcid.%d.", vcid)
+		policy := layer.DefaultPolicy()
+		set := false
+		if fill := p.stringOption(prefix+"fill", ""); fill != "" {
+			if f, err := lrit.ParseFillPolicy(fill); err == nil {
+				policy.Fill = f
+				set = true
+			} else {
+				log.Error(err)
+			}
+		}
+		if p.optionExists(prefix + "continue_on_crc_failure") {
+			policy.ContinueOnCRCFailure = p.boolOption(prefix+"continue_on_crc_failure", policy.ContinueOnCRCFailure)
+			set = true
+		}
+		if set {
+			layer.SetPolicy(vcid, policy)
+		}
+	}
+}
+
+// Reads which APIDs carry time codes, from transport.vcid.<vcid>.time_codes, which maps APIDs to a time code format
+// (see packets.ParseTimeCodeFormat)
+func (p *Pipeline) loadTimeCodes(layer *transport.TransportLayer) {
+	for vcid := 0; vcid < 64; vcid++ {
+		for apid, spec := range p.stringMapOption(fmt.Sprintf("transport.vcid.%d.time_codes", vcid)) {
+			n, err := strconv.Atoi(apid)
+			if err != nil || n < 0 || n > 2047 {
+				log.Errorf("Invalid APID in time code config: %s", apid)
+				continue
+			}
+			if format, err := packets.ParseTimeCodeFormat(spec); err == nil {
+				layer.SetTimeCode(vcid, n, format)
+			} else {
+				log.Error(err)
+			}
+		}
+	}
+}
+
+func (p *Pipeline) optionExists(key string) bool {
+	if p.configFile != nil {
+		return p.configFile.Exists(key)
+	}
+	_, ok := p.options[key]
+	return ok
+}
@@ -2,13 +2,17 @@ package pipeline
 
 import (
 	"fmt"
+	"strconv"
 
+	"github.com/charmbracelet/log"
 	"github.com/jrwynneiii/ccsds_tools"
 	"github.com/jrwynneiii/ccsds_tools/layers/datalink"
 	"github.com/jrwynneiii/ccsds_tools/layers/physical"
 	"github.com/jrwynneiii/ccsds_tools/layers/session"
 	"github.com/jrwynneiii/ccsds_tools/layers/transport"
 	"github.com/jrwynneiii/ccsds_tools/lrit"
+	"github.com/jrwynneiii/ccsds_tools/mission"
+	"github.com/jrwynneiii/ccsds_tools/packets"
 	"github.com/jrwynneiii/ccsds_tools/types"
 	"github.com/knadh/koanf/v2"
 )
@@ -20,28 +24,56 @@ type Pipeline struct {
 	configFile          *koanf.Koanf
 	options             map[string]any
 	NumLayersRegistered int
+	Mission             mission.Profile
 }
 
 func New(configFile *koanf.Koanf) *Pipeline {
 	srate := configFile.Float64("radio.sample_rate")
 	bufsize := uint(configFile.Int("xrit.chunk_size"))
-	return &Pipeline{
+	p := &Pipeline{
 		SampleRate: float32(srate),
 		BufferSize: bufsize,
 		Layers:     make([]ccsds_tools.Layer, 6),
 		configFile: configFile,
 	}
+	p.loadMission()
+	return p
 }
 
 func NewWithOptionsMap(options map[string]any) *Pipeline {
 	srate := options["radio.sample_rate"].(float64)
 	bufsize := uint(options["xrit.chunk_size"].(int))
-	return &Pipeline{
+	p := &Pipeline{
 		SampleRate: float32(srate),
 		BufferSize: bufsize,
 		Layers:     make([]ccsds_tools.Layer, 6),
 		options:    options,
 	}
+	p.loadMission()
+	return p
+}
+
+// Selects the mission profile, which supplies the defaults for any frame/demodulator settings left out of the config
+func (p *Pipeline) loadMission() {
+	var err error
+	name := p.stringOption("mission", mission.DefaultProfile)
+	if p.Mission, err = mission.Lookup(name); err != nil {
+		log.Errorf("%s; falling back to %s", err.Error(), mission.DefaultProfile)
+		p.Mission, _ = mission.Lookup(mission.DefaultProfile)
+	}
+}
+
+func (p *Pipeline) frameFormat() mission.FrameFormat {
+	return mission.FrameFormat(p.stringOption("xritframe.format", string(p.Mission.FrameFormat)))
+}
+
+// The size of the frames the data link layer hands to the transport layer: the coded frame without its sync word and
+// RS parity. 0 (the parser's default) if the layer below isn't a data link decoder
+func (p *Pipeline) transferFrameSize(id ccsds_tools.LayerType) int {
+	if d, ok := p.Layers[id-1].(*datalink.Decoder); ok {
+		return d.FrameSize - d.SyncWordSize - d.RSParityBlockSize
+	}
+	return 0
 }
 
 // TODO: Add a RegisterWithOptions() method that takes a map of options, where the map == map[LayerType]OptionStruct,
@@ -56,11 +88,11 @@ func (p *Pipeline) Register(id ccsds_tools.LayerType) {
 		var clockConf types.ClockRecoveryConf
 		if p.configFile != nil {
 			xritConf = types.XRITConf{
-				SymbolRate:             p.configFile.Float64("xrit.symbol_rate"),
-				RRCAlpha:               p.configFile.Float64("xrit.rrc_alpha"),
-				RRCTaps:                p.configFile.Int("xrit.rrc_taps"),
+				SymbolRate:             p.float64Option("xrit.symbol_rate", p.Mission.SymbolRate),
+				RRCAlpha:               p.float64Option("xrit.rrc_alpha", p.Mission.RRCAlpha),
+				RRCTaps:                p.intOption("xrit.rrc_taps", p.Mission.RRCTaps),
 				LowPassTransitionWidth: p.configFile.Float64("xrit.lowpass_transition_width"),
-				PLLAlpha:               float32(p.configFile.Float64("xrit.pll_alpha")),
+				PLLAlpha:               float32(p.float64Option("xrit.pll_alpha", float64(p.Mission.PLLAlpha))),
 				Decimation:             p.configFile.Int("xrit.decimation_factor"),
 				ChunkSize:              uint(p.configFile.Int("xrit.chunk_size")),
 				DoFFT:                  p.configFile.Bool("xrit.do_fft"),
@@ -80,11 +112,11 @@ func (p *Pipeline) Register(id ccsds_tools.LayerType) {
 			}
 		} else {
 			xritConf = types.XRITConf{
-				SymbolRate:             p.options["xrit.symbol_rate"].(float64),
-				RRCAlpha:               p.options["xrit.rrc_alpha"].(float64),
-				RRCTaps:                p.options["xrit.rrc_taps"].(int),
+				SymbolRate:             p.float64Option("xrit.symbol_rate", p.Mission.SymbolRate),
+				RRCAlpha:               p.float64Option("xrit.rrc_alpha", p.Mission.RRCAlpha),
+				RRCTaps:                p.intOption("xrit.rrc_taps", p.Mission.RRCTaps),
 				LowPassTransitionWidth: p.options["xrit.lowpass_transition_width"].(float64),
-				PLLAlpha:               float32(p.options["xrit.pll_alpha"].(float64)),
+				PLLAlpha:               float32(p.float64Option("xrit.pll_alpha", float64(p.Mission.PLLAlpha))),
 				Decimation:             p.options["xrit.decimation_factor"].(int),
 				ChunkSize:              uint(p.options["xrit.chunk_size"].(int)),
 				DoFFT:                  p.options["xrit.do_fft"].(bool),
@@ -108,7 +140,7 @@ func (p *Pipeline) Register(id ccsds_tools.LayerType) {
 		p.Layers[id] = layer
 		p.NumLayersRegistered++
 	case ccsds_tools.DataLinkLayer:
-		output := make(chan []byte, p.BufferSize)
+		output := make(chan packets.Frame, p.BufferSize)
 
 		var vitConf types.ViterbiConf
 		var xritConf types.XRITFrameConf
@@ -116,31 +148,95 @@ func (p *Pipeline) Register(id ccsds_tools.LayerType) {
 			vitConf = types.ViterbiConf{
 				MaxErrors: p.configFile.Int("viterbi.max_errors"),
 			}
-			xritConf = types.XRITFrameConf{
-				FrameSize:     p.configFile.Int("xritframe.frame_size"),
-				LastFrameSize: p.configFile.Int("xritframe.last_frame_size"),
-			}
 		} else {
 			vitConf = types.ViterbiConf{
 				MaxErrors: p.options["viterbi.max_errors"].(int),
 			}
-			xritConf = types.XRITFrameConf{
-				FrameSize:     p.options["xritframe.frame_size"].(int),
-				LastFrameSize: p.options["xritframe.last_frame_size"].(int),
-			}
+		}
+		xritConf = types.XRITFrameConf{
+			FrameSize:      p.intOption("xritframe.frame_size", p.Mission.FrameSize),
+			LastFrameSize:  p.intOption("xritframe.last_frame_size", p.Mission.LastFrameSize),
+			DisableNRZM:    p.boolOption("xritframe.disable_nrzm", !p.Mission.NRZM),
+			DecodeWorkers:  p.intOption("xritframe.decode_workers", 0),
+			SyncWord0Deg:   p.uint64Option("xritframe.sync_word_0", p.Mission.SyncWord0Deg),
+			SyncWord180Deg: p.uint64Option("xritframe.sync_word_180", p.Mission.SyncWord180Deg),
 		}
 
 		layer := datalink.New(p.BufferSize, vitConf, xritConf, p.Layers[id-1].GetOutput().(*chan byte), &output)
+		layer.VCIDNames = p.Mission.VCIDs
+		if p.frameFormat() == mission.TMFrameFormat {
+			layer.FrameVCID = packets.TMVCID
+		}
 		p.Layers[id] = layer
 		p.NumLayersRegistered++
 	case ccsds_tools.TransportLayer:
 		output := make(chan lrit.File, p.BufferSize)
-		layer := transport.New(p.Layers[id-1].GetOutput().(*chan []byte), &output)
+		layer := transport.New(p.Layers[id-1].GetOutput().(*chan packets.Frame), &output)
+
+		layer.IdleVCID = uint8(p.Mission.IdleVCID)
+		frameOpts := transport.FrameOptions{
+			FrameSize:        p.intOption("xritframe.transfer_frame_size", p.transferFrameSize(id)),
+			FECF:             p.boolOption("xritframe.fecf", p.Mission.FECF),
+			FHEC:             p.boolOption("xritframe.fhec", p.Mission.FHEC),
+			InsertZoneLength: p.intOption("xritframe.insert_zone_length", p.Mission.InsertZoneLength),
+			PacketCRC:        p.boolOption("xritframe.packet_crc", p.Mission.PacketCRC),
+		}
+		if parser, err := transport.NewFrameParser(string(p.frameFormat()), frameOpts); err == nil {
+			layer.Parser = parser
+		} else {
+			log.Error(err)
+		}
+		layer.AssembleFiles = p.boolOption("transport.assemble_files", true)
+		layer.Concurrent = p.boolOption("transport.concurrent", false)
+		layer.QueueSize = p.intOption("transport.queue_size", layer.QueueSize)
+		layer.DropOnOverflow = p.boolOption("transport.drop_on_overflow", false)
+		layer.ContinueOnCRCFailure = p.boolOption("transport.continue_on_crc_failure", layer.ContinueOnCRCFailure)
+		// Older configs choose between zero and last row fill with this. transport.fill takes precedence
+		if p.optionExists("transport.fill_missing_sdu_with_null") {
+			layer.Fill = lrit.FillLastRow
+			if p.boolOption("transport.fill_missing_sdu_with_null", true) {
+				layer.Fill = lrit.FillZero
+			}
+		}
+		p.loadAssemblyPolicies(layer)
+		p.loadTimeCodes(layer)
+		if replay := p.stringOption("transport.replay", ""); replay != "" {
+			if policy, err := transport.ParseReplayPolicy(replay); err == nil {
+				layer.SetReplayPolicy(policy)
+			} else {
+				log.Error(err)
+			}
+		}
+		layer.SetEvictionPolicy(transport.EvictionPolicy{
+			MaxAge:         p.durationOption("transport.max_file_age", 0),
+			MaxBytes:       p.intOption("transport.max_pending_bytes", 0),
+			EmitIncomplete: p.boolOption("transport.emit_incomplete", false),
+		})
+		if p.boolOption("transport.packet_output", false) {
+			layer.EnablePacketOutput(p.BufferSize)
+		}
+		for scid, name := range p.Mission.Spacecraft {
+			packets.RegisterSpacecraft(scid, name)
+		}
+		packets.SetOwnProductVCIDs(p.Mission.OwnProductVCIDs)
+
+		for _, scid := range p.intsOption("transport.expected_scids") {
+			layer.ExpectSCID(scid)
+		}
+		for scid, name := range p.stringMapOption("spacecraft") {
+			if n, err := strconv.Atoi(scid); err == nil && n >= 0 && n < 1024 {
+				packets.RegisterSpacecraft(uint16(n), name)
+			} else {
+				log.Errorf("Invalid spacecraft ID in config: %s", scid)
+			}
+		}
+
 		p.Layers[id] = layer
 		p.NumLayersRegistered++
 	case ccsds_tools.SessionLayer:
 		output := make(chan *lrit.File, p.BufferSize)
 		layer := session.New(p.Layers[id-1].GetOutput().(*chan lrit.File), &output)
+		layer.AdminMessages.Max = p.intOption("session.admin_history", layer.AdminMessages.Max)
 		p.Layers[id] = layer
 		p.NumLayersRegistered++
 	case ccsds_tools.PresentationLayer:
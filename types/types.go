@@ -25,8 +25,13 @@ type XRITConf struct {
 }
 
 type XRITFrameConf struct {
-	FrameSize     int `koanf:"frame_size"`
-	LastFrameSize int `koanf:"last_frame_size"`
+	FrameSize     int  `koanf:"frame_size"`
+	LastFrameSize int  `koanf:"last_frame_size"`
+	DisableNRZM   bool `koanf:"disable_nrzm"`
+	DecodeWorkers int  `koanf:"decode_workers"`
+	// Encoded sync words. The GOES-R HRIT words are used if these are 0
+	SyncWord0Deg   uint64 `koanf:"sync_word_0"`
+	SyncWord180Deg uint64 `koanf:"sync_word_180"`
 }
 
 type ViterbiConf struct {